@@ -0,0 +1,122 @@
+// yaegi-template-gen transpiles a template into a go source file.
+//
+// It is meant to be used with go generate:
+//    //go:generate go run github.com/Eun/yaegi-template/cmd/yaegi-template-gen -in page.tmpl -func RenderPage -context *Page
+//
+// The generated file contains a function
+//    func RenderPage(w io.Writer, context *Page) error
+// that renders the template without using the interpreter.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	yaegi_template "github.com/Eun/yaegi-template"
+)
+
+type importsFlag []yaegi_template.Import
+
+func (i *importsFlag) String() string {
+	return fmt.Sprint(*i)
+}
+
+// Set parses an import in the form "path" or "name=path".
+func (i *importsFlag) Set(s string) error {
+	var imp yaegi_template.Import
+	if pos := strings.IndexRune(s, '='); pos >= 0 {
+		imp.Name = s[:pos]
+		s = s[pos+1:]
+	}
+	imp.Path = s
+	*i = append(*i, imp)
+	return nil
+}
+
+type importMapFlag map[string]string
+
+func (m importMapFlag) String() string {
+	return fmt.Sprint(map[string]string(m))
+}
+
+// Set parses a mapping in the form "template/path=go/path".
+func (m importMapFlag) Set(s string) error {
+	pos := strings.IndexRune(s, '=')
+	if pos < 0 {
+		return fmt.Errorf("invalid import mapping %q, expected template/path=go/path", s)
+	}
+	m[s[:pos]] = s[pos+1:]
+	return nil
+}
+
+func main() {
+	var options yaegi_template.GenerateOptions
+	importMap := make(importMapFlag)
+	var imports importsFlag
+
+	in := flag.String("in", "", "template file to transpile")
+	out := flag.String("out", "", "output file, defaults to the input file with a .go extension")
+	startTokens := flag.String("start", "<$", "start tokens of code blocks")
+	endTokens := flag.String("end", "$>", "end tokens of code blocks")
+	prelude := flag.String("prelude", "", "file that contains go code that should be used as prelude")
+	flag.StringVar(&options.Package, "pkg", os.Getenv("GOPACKAGE"), "package name of the generated file")
+	flag.StringVar(&options.FuncName, "func", "Render", "name of the generated function")
+	flag.StringVar(&options.ContextType, "context", "interface{}", "type of the context parameter")
+	flag.Var(&imports, "import", "additional import for the generated file, in the form path or name=path (can be repeated)")
+	flag.Var(importMap, "importmap", "maps an import path of the template to a go import path, in the form template/path=go/path (can be repeated)")
+	flag.Parse()
+
+	if *in == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(*in, ".tmpl") + ".go"
+	}
+	options.Imports = imports
+	options.ImportMap = importMap
+
+	if err := run(*in, *out, *startTokens, *endTokens, *prelude, options); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(in, out, startTokens, endTokens, prelude string, options yaegi_template.GenerateOptions) error { //nolint:gocritic // options is passed once
+	template, err := yaegi_template.New(yaegi_template.DefaultOptions(), yaegi_template.DefaultSymbols()...)
+	if err != nil {
+		return err
+	}
+	template.StartTokens = []rune(startTokens)
+	template.EndTokens = []rune(endTokens)
+
+	if prelude != "" {
+		code, err := ioutil.ReadFile(prelude)
+		if err != nil {
+			return err
+		}
+		if err := template.Prelude(string(code)); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := template.Parse(f); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := template.Generate(&buf, options); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(out, buf.Bytes(), 0600)
+}
@@ -24,6 +24,9 @@ const (
 type Part struct {
 	Type    PartType
 	Content []byte
+	// Line and Column are the position of the content in the text, both start at 1.
+	Line   int
+	Column int
 }
 
 const (
@@ -28,6 +28,10 @@ type liveIterator struct {
 	currentPart             *Part
 	hasNext                 bool
 	stripLeadingWhiteSpaces bool
+	// line and column are the current position in the reader.
+	line, column int
+	// previousLine and previousColumn are the position before the last read rune, they are used for UnreadRune.
+	previousLine, previousColumn int
 }
 
 func newLiveIterator(state *atomic.Int32, parts *[]*Part, reader io.Reader, startSequence, endSequence []rune) (Iterator, error) {
@@ -38,6 +42,8 @@ func newLiveIterator(state *atomic.Int32, parts *[]*Part, reader io.Reader, star
 		startSequence: startSequence,
 		endSequence:   endSequence,
 		hasNext:       true,
+		line:          1,
+		column:        1,
 	}, nil
 }
 
@@ -87,6 +93,7 @@ func (i *liveIterator) stopProcessing(err error) bool {
 
 //nolint:gocognit // allow more complex code here
 func (i *liveIterator) readTextBlock() (*Part, bool, error) {
+	line, column := i.line, i.column
 	sequenceSize := len(i.startSequence)
 	if sequenceSize == 0 {
 		// shortcut, also a special case, if there is no sequence present treat everything as code
@@ -97,7 +104,7 @@ func (i *liveIterator) readTextBlock() (*Part, bool, error) {
 			}
 			err = nil
 		}
-		return constructCodePath(p), true, err
+		return constructCodePath(p, line, column), true, err
 	}
 	pos := 0
 	seqBuffer := make([]rune, sequenceSize)
@@ -116,7 +123,7 @@ func (i *liveIterator) readTextBlock() (*Part, bool, error) {
 	}
 
 	for {
-		r, rsize, err := readRune(i.reader)
+		r, rsize, err := i.readRune()
 		if err != nil {
 			return nil, true, err
 		}
@@ -127,7 +134,7 @@ func (i *liveIterator) readTextBlock() (*Part, bool, error) {
 			}
 			stripLeadingWhiteSpaces := i.stripLeadingWhiteSpaces
 			i.stripLeadingWhiteSpaces = false // reset strip leading whitespaces
-			return constructTextPart(contentBuffer.Bytes(), stripLeadingWhiteSpaces), true, nil
+			return constructTextPart(contentBuffer.Bytes(), stripLeadingWhiteSpaces, line, column), true, nil
 		}
 
 		if r == i.startSequence[pos] { //nolint:nestif // moving this block into a function would make this more complex
@@ -141,7 +148,7 @@ func (i *liveIterator) readTextBlock() (*Part, bool, error) {
 			content := contentBuffer.Bytes()
 
 			// test if the next rune is a "-" indicating we should strip previous white spaces
-			r, _, err = readRune(i.reader)
+			r, _, err = i.readRune()
 			if err != nil {
 				return nil, true, err
 			}
@@ -150,7 +157,7 @@ func (i *liveIterator) readTextBlock() (*Part, bool, error) {
 				content = bytes.TrimRightFunc(content, unicode.IsSpace)
 			} else { //nolint:elseif,gocritic // for better readability keep a nested if
 				// its not an "-"
-				if err := i.reader.UnreadRune(); err != nil {
+				if err := i.unreadRune(); err != nil {
 					return nil, true, err
 				}
 			}
@@ -158,7 +165,7 @@ func (i *liveIterator) readTextBlock() (*Part, bool, error) {
 			i.inCodeBlock = true
 			stripLeadingWhiteSpaces := i.stripLeadingWhiteSpaces
 			i.stripLeadingWhiteSpaces = false // reset strip leading whitespaces
-			return constructTextPart(content, stripLeadingWhiteSpaces), false, nil
+			return constructTextPart(content, stripLeadingWhiteSpaces, line, column), false, nil
 		}
 		if err := writeSeqBuffer(); err != nil {
 			return nil, true, err
@@ -176,6 +183,7 @@ func (i *liveIterator) readTextBlock() (*Part, bool, error) {
 
 //nolint:gocognit  // allow more complex code here
 func (i *liveIterator) readCodeBlock() (*Part, bool, error) {
+	line, column := i.line, i.column
 	sequenceSize := len(i.endSequence)
 	if sequenceSize == 0 {
 		// shortcut
@@ -186,7 +194,7 @@ func (i *liveIterator) readCodeBlock() (*Part, bool, error) {
 			}
 			err = nil
 		}
-		return constructCodePath(p), true, err
+		return constructCodePath(p, line, column), true, err
 	}
 	pos := 0
 	seqBuffer := make([]rune, sequenceSize)
@@ -205,7 +213,7 @@ func (i *liveIterator) readCodeBlock() (*Part, bool, error) {
 	}
 
 	for {
-		r, rsize, err := readRune(i.reader)
+		r, rsize, err := i.readRune()
 		if err != nil {
 			return nil, true, err
 		}
@@ -214,7 +222,7 @@ func (i *liveIterator) readCodeBlock() (*Part, bool, error) {
 			if err := writeSeqBuffer(); err != nil {
 				return nil, true, err
 			}
-			return constructCodePath(contentBuffer.Bytes()), true, nil
+			return constructCodePath(contentBuffer.Bytes(), line, column), true, nil
 		}
 
 		if r == i.endSequence[pos] {
@@ -233,7 +241,7 @@ func (i *liveIterator) readCodeBlock() (*Part, bool, error) {
 			}
 
 			i.inCodeBlock = false
-			return constructCodePath(contentBuffer.Bytes()), false, nil
+			return constructCodePath(contentBuffer.Bytes(), line, column), false, nil
 		}
 
 		if err := writeSeqBuffer(); err != nil {
@@ -262,9 +270,11 @@ func (i *liveIterator) addPart(p *Part) bool {
 	return true
 }
 
-func constructTextPart(content []byte, trimLeadingSpaces bool) *Part {
+func constructTextPart(content []byte, trimLeadingSpaces bool, line, column int) *Part {
 	if trimLeadingSpaces {
-		content = bytes.TrimLeftFunc(content, unicode.IsSpace)
+		trimmed := bytes.TrimLeftFunc(content, unicode.IsSpace)
+		line, column = advance(line, column, content[:len(content)-len(trimmed)])
+		content = trimmed
 	}
 
 	if len(content) == 0 {
@@ -273,19 +283,61 @@ func constructTextPart(content []byte, trimLeadingSpaces bool) *Part {
 	return &Part{
 		Type:    TextPartType,
 		Content: content,
+		Line:    line,
+		Column:  column,
 	}
 }
 
-func constructCodePath(content []byte) *Part {
+func constructCodePath(content []byte, line, column int) *Part {
 	if len(content) == 0 {
 		return nil
 	}
 	return &Part{
 		Type:    CodePartType,
 		Content: content,
+		Line:    line,
+		Column:  column,
 	}
 }
 
+// advance returns the position after b.
+func advance(line, column int, b []byte) (int, int) {
+	for _, r := range string(b) {
+		if r == '\n' {
+			line++
+			column = 1
+			continue
+		}
+		column++
+	}
+	return line, column
+}
+
+// readRune reads the next rune and keeps track of the position.
+func (i *liveIterator) readRune() (r rune, size int, err error) {
+	r, size, err = readRune(i.reader)
+	if err != nil || size == 0 {
+		return r, size, err
+	}
+	i.previousLine, i.previousColumn = i.line, i.column
+	if r == '\n' {
+		i.line++
+		i.column = 1
+	} else {
+		i.column++
+	}
+	return r, size, err
+}
+
+// unreadRune unreads the last rune, it can only be called once after readRune.
+func (i *liveIterator) unreadRune() error {
+	if err := i.reader.UnreadRune(); err != nil {
+		return err
+	}
+	i.line, i.column = i.previousLine, i.previousColumn
+	return nil
+}
+
 func (i *liveIterator) Value() *Part {
 	return i.currentPart
 }
@@ -33,6 +33,8 @@ func TestLiveIterator(t *testing.T) {
 				{
 					Type:    TextPartType,
 					Content: []byte("Foo Bar"),
+					Line:    1,
+					Column:  1,
 				},
 			},
 		},
@@ -45,10 +47,14 @@ func TestLiveIterator(t *testing.T) {
 				{
 					Type:    TextPartType,
 					Content: []byte("Foo "),
+					Line:    1,
+					Column:  1,
 				},
 				{
 					Type:    CodePartType,
 					Content: []byte(" Bar "),
+					Line:    1,
+					Column:  7,
 				},
 			},
 		},
@@ -61,10 +67,14 @@ func TestLiveIterator(t *testing.T) {
 				{
 					Type:    CodePartType,
 					Content: []byte(" Foo "),
+					Line:    1,
+					Column:  3,
 				},
 				{
 					Type:    TextPartType,
 					Content: []byte(" Bar"),
+					Line:    1,
+					Column:  10,
 				},
 			},
 		},
@@ -77,14 +87,20 @@ func TestLiveIterator(t *testing.T) {
 				{
 					Type:    TextPartType,
 					Content: []byte("Foo "),
+					Line:    1,
+					Column:  1,
 				},
 				{
 					Type:    CodePartType,
 					Content: []byte(" Bar "),
+					Line:    1,
+					Column:  7,
 				},
 				{
 					Type:    TextPartType,
 					Content: []byte(" Baz"),
+					Line:    1,
+					Column:  14,
 				},
 			},
 		},
@@ -97,14 +113,20 @@ func TestLiveIterator(t *testing.T) {
 				{
 					Type:    TextPartType,
 					Content: []byte("Foo"),
+					Line:    1,
+					Column:  1,
 				},
 				{
 					Type:    CodePartType,
 					Content: []byte(" Bar "),
+					Line:    1,
+					Column:  8,
 				},
 				{
 					Type:    TextPartType,
 					Content: []byte("Baz"),
+					Line:    1,
+					Column:  17,
 				},
 			},
 		},
@@ -117,6 +139,8 @@ func TestLiveIterator(t *testing.T) {
 				{
 					Type:    CodePartType,
 					Content: []byte(" Bar "),
+					Line:    1,
+					Column:  4,
 				},
 			},
 		},
@@ -129,6 +153,8 @@ func TestLiveIterator(t *testing.T) {
 				{
 					Type:    CodePartType,
 					Content: []byte(" Bar "),
+					Line:    1,
+					Column:  4,
 				},
 			},
 		},
@@ -141,10 +167,14 @@ func TestLiveIterator(t *testing.T) {
 				{
 					Type:    TextPartType,
 					Content: []byte("Foo"),
+					Line:    1,
+					Column:  1,
 				},
 				{
 					Type:    CodePartType,
 					Content: []byte(" Bar "),
+					Line:    1,
+					Column:  8,
 				},
 			},
 		},
@@ -157,6 +187,8 @@ func TestLiveIterator(t *testing.T) {
 				{
 					Type:    CodePartType,
 					Content: []byte("Foo Bar"),
+					Line:    1,
+					Column:  1,
 				},
 			},
 		},
@@ -169,10 +201,14 @@ func TestLiveIterator(t *testing.T) {
 				{
 					Type:    TextPartType,
 					Content: []byte("Foo"),
+					Line:    1,
+					Column:  1,
 				},
 				{
 					Type:    CodePartType,
 					Content: []byte(" Bar"),
+					Line:    1,
+					Column:  8,
 				},
 			},
 		},
@@ -185,10 +221,14 @@ func TestLiveIterator(t *testing.T) {
 				{
 					Type:    TextPartType,
 					Content: []byte("Foo <-$ Bar "),
+					Line:    1,
+					Column:  1,
 				},
 				{
 					Type:    CodePartType,
 					Content: []byte(" Baz "),
+					Line:    1,
+					Column:  15,
 				},
 			},
 		},
@@ -201,14 +241,20 @@ func TestLiveIterator(t *testing.T) {
 				{
 					Type:    TextPartType,
 					Content: []byte("Foo "),
+					Line:    1,
+					Column:  1,
 				},
 				{
 					Type:    CodePartType,
 					Content: []byte(" Bar $-> Baz "),
+					Line:    1,
+					Column:  7,
 				},
 				{
 					Type:    TextPartType,
 					Content: []byte(" Taz"),
+					Line:    1,
+					Column:  22,
 				},
 			},
 		},
@@ -221,6 +267,8 @@ func TestLiveIterator(t *testing.T) {
 				{
 					Type:    TextPartType,
 					Content: []byte("Foo <"),
+					Line:    1,
+					Column:  1,
 				},
 			},
 		},
@@ -233,10 +281,14 @@ func TestLiveIterator(t *testing.T) {
 				{
 					Type:    TextPartType,
 					Content: []byte("Foo "),
+					Line:    1,
+					Column:  1,
 				},
 				{
 					Type:    CodePartType,
 					Content: []byte(" Bar $"),
+					Line:    1,
+					Column:  7,
 				},
 			},
 		},
@@ -249,10 +301,14 @@ func TestLiveIterator(t *testing.T) {
 				{
 					Type:    TextPartType,
 					Content: []byte("Foo "),
+					Line:    1,
+					Column:  1,
 				},
 				{
 					Type:    TextPartType,
 					Content: []byte(" Bar"),
+					Line:    1,
+					Column:  9,
 				},
 			},
 		},
@@ -267,22 +323,32 @@ Baz:<$Taz$>`,
 				{
 					Type:    CodePartType,
 					Content: []byte(`import "time"`),
+					Line:    1,
+					Column:  4,
 				},
 				{
 					Type:    TextPartType,
 					Content: []byte("Foo:"),
+					Line:    2,
+					Column:  1,
 				},
 				{
 					Type:    CodePartType,
 					Content: []byte("Bar"),
+					Line:    2,
+					Column:  7,
 				},
 				{
 					Type:    TextPartType,
 					Content: []byte("\nBaz:"),
+					Line:    2,
+					Column:  12,
 				},
 				{
 					Type:    CodePartType,
 					Content: []byte("Taz"),
+					Line:    3,
+					Column:  7,
 				},
 			},
 		},
@@ -0,0 +1,239 @@
+package yaegi_template
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+// DefaultEgressTimeout is the timeout of requests and connections, if EgressPolicy.Timeout is not set.
+const DefaultEgressTimeout = 30 * time.Second
+
+// egressPackages are the packages that are removed from the exports if an egress policy is used,
+// because they can open network connections.
+var egressPackages = []string{
+	"net/net",
+	"net/http/",
+	"net/rpc/",
+	"net/smtp/smtp",
+	"net/textproto/textproto",
+	"crypto/tls/tls",
+	"log/syslog/syslog",
+	"expvar/expvar",
+}
+
+// EgressPolicy restricts the network connections of templates, see Template.UseEgress().
+type EgressPolicy struct {
+	// Allow holds the host:port patterns of the allowed connections, e.g. "api.internal:443", "*.example.com:*" or
+	// "127.0.0.1:8080". The host and the port can contain the wildcards of path.Match, a pattern without port allows
+	// all ports.
+	Allow []string
+	// MaxRequests limits the number of http requests and connections per Exec(), 0 means unlimited.
+	MaxRequests int
+	// Timeout is the timeout of every request and connection, DefaultEgressTimeout is used if it is 0.
+	Timeout time.Duration
+}
+
+// Allowed returns nil if a connection to address (host:port) is allowed by the policy.
+func (p *EgressPolicy) Allowed(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Wrapf(err, "invalid address %q", address)
+	}
+	host = strings.ToLower(host)
+	for _, pattern := range p.Allow {
+		patternHost, patternPort, err := net.SplitHostPort(pattern)
+		if err != nil {
+			// pattern without port
+			patternHost, patternPort = strings.Trim(pattern, "[]"), "*"
+		}
+		if ok, _ := path.Match(strings.ToLower(patternHost), host); !ok {
+			continue
+		}
+		if ok, _ := path.Match(patternPort, port); ok {
+			return nil
+		}
+	}
+	return errors.Errorf("connection to %s is not allowed", address)
+}
+
+// UseEgress restricts the network access of the template to the policy.
+// The net and net/http packages are replaced with versions that only connect to the allowed addresses, other
+// packages that can open connections (e.g. net/smtp and crypto/tls) are removed.
+// The net/http package provides Get, Head, Post, PostForm and Do (instead of http.Client), the net package provides
+// Dial and DialTimeout.
+// UseEgress must be called before parsing.
+//    template.MustUseEgress(yaegi_template.EgressPolicy{
+//        Allow:       []string{"api.internal:443"},
+//        MaxRequests: 10,
+//    })
+func (t *Template) UseEgress(policy EgressPolicy) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.interp != nil {
+		return errors.New("the egress policy must be set before the template gets parsed")
+	}
+	for _, pattern := range policy.Allow {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "invalid egress pattern %q", pattern)
+		}
+	}
+	t.egress = newEgress(policy)
+	return nil
+}
+
+// MustUseEgress is like UseEgress, except it panics on failure.
+func (t *Template) MustUseEgress(policy EgressPolicy) *Template {
+	if err := t.UseEgress(policy); err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// egress enforces an EgressPolicy.
+type egress struct {
+	policy    EgressPolicy
+	transport *http.Transport
+	client    *http.Client
+
+	mu       sync.Mutex
+	requests int
+}
+
+func newEgress(policy EgressPolicy) *egress {
+	if policy.Timeout == 0 {
+		policy.Timeout = DefaultEgressTimeout
+	}
+	e := &egress{policy: policy}
+	e.transport = &http.Transport{
+		// no proxy, it would allow connections to every address
+		Proxy:                 nil,
+		DialContext:           e.dialContext,
+		TLSHandshakeTimeout:   policy.Timeout,
+		ResponseHeaderTimeout: policy.Timeout,
+	}
+	e.client = &http.Client{
+		Transport: egressTransport{e},
+		Timeout:   policy.Timeout,
+	}
+	return e
+}
+
+// reset resets the request counter, it is called before every execution.
+func (e *egress) reset() {
+	e.mu.Lock()
+	e.requests = 0
+	e.mu.Unlock()
+	e.transport.CloseIdleConnections()
+}
+
+// count counts a request or a connection.
+func (e *egress) count() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.policy.MaxRequests > 0 && e.requests >= e.policy.MaxRequests {
+		return errors.Errorf("the maximum of %d requests was reached", e.policy.MaxRequests)
+	}
+	e.requests++
+	return nil
+}
+
+// dialContext opens a connection, if the address is allowed.
+func (e *egress) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := e.policy.Allowed(address); err != nil {
+		return nil, err
+	}
+	dialer := net.Dialer{Timeout: e.policy.Timeout}
+	return dialer.DialContext(ctx, network, address)
+}
+
+func (e *egress) dial(network, address string) (net.Conn, error) {
+	return e.dialTimeout(network, address, e.policy.Timeout)
+}
+
+func (e *egress) dialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	if err := e.count(); err != nil {
+		return nil, err
+	}
+	if timeout <= 0 || timeout > e.policy.Timeout {
+		timeout = e.policy.Timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return e.dialContext(ctx, network, address)
+}
+
+// egressTransport counts the requests.
+type egressTransport struct {
+	e *egress
+}
+
+func (t egressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.e.count(); err != nil {
+		return nil, err
+	}
+	return t.e.transport.RoundTrip(req)
+}
+
+// replace returns the exports with the packages that can open connections replaced by the restricted ones.
+func (e *egress) replace(exports interp.Exports) interp.Exports {
+	result := make(interp.Exports, len(exports)+2)
+	for key, symbols := range exports {
+		if !isEgressPackage(key) {
+			result[key] = symbols
+		}
+	}
+	for key, symbols := range e.exports() {
+		result[key] = symbols
+	}
+	return result
+}
+
+func isEgressPackage(key string) bool {
+	for _, p := range egressPackages {
+		if key == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(key, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// exports returns the restricted net and net/http packages.
+func (e *egress) exports() interp.Exports {
+	netSymbols := copySymbols("net/net",
+		"Addr", "Conn", "Error", "ErrClosed", "IP", "IPMask", "IPNet", "IPv4", "IPv4Mask",
+		"JoinHostPort", "ParseCIDR", "ParseIP", "SplitHostPort",
+	)
+	netSymbols["Dial"] = reflect.ValueOf(e.dial)
+	netSymbols["DialTimeout"] = reflect.ValueOf(e.dialTimeout)
+
+	httpSymbols := copySymbols("net/http/http",
+		"CanonicalHeaderKey", "Cookie", "DetectContentType", "ErrNoCookie", "ErrUseLastResponse", "Header",
+		"NewRequest", "NewRequestWithContext", "NoBody", "ParseTime", "Request", "Response", "StatusText",
+		"TimeFormat",
+	)
+	for name, value := range stdlib.Symbols["net/http/http"] {
+		if strings.HasPrefix(name, "Status") || strings.HasPrefix(name, "Method") {
+			httpSymbols[name] = value
+		}
+	}
+	httpSymbols["Get"] = reflect.ValueOf(e.client.Get)
+	httpSymbols["Head"] = reflect.ValueOf(e.client.Head)
+	httpSymbols["Post"] = reflect.ValueOf(e.client.Post)
+	httpSymbols["PostForm"] = reflect.ValueOf(e.client.PostForm)
+	httpSymbols["Do"] = reflect.ValueOf(e.client.Do)
+
+	return interp.Exports{
+		"net/net":       netSymbols,
+		"net/http/http": httpSymbols,
+	}
+}
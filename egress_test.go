@@ -0,0 +1,101 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+func TestEgressPolicy_Allowed(t *testing.T) {
+	policy := EgressPolicy{Allow: []string{"api.internal:443", "*.example.com:*", "127.0.0.1", "[::1]:80"}}
+	for address, allowed := range map[string]bool{
+		"api.internal:443":   true,
+		"API.internal:443":   true,
+		"api.internal:80":    false,
+		"www.example.com:80": true,
+		"example.com:80":     false,
+		"127.0.0.1:1234":     true,
+		"[::1]:80":           true,
+		"[::1]:81":           false,
+		"10.0.0.1:443":       false,
+		"invalid":            false,
+	} {
+		err := policy.Allowed(address)
+		if allowed {
+			require.NoError(t, err, address)
+		} else {
+			require.Error(t, err, address)
+		}
+	}
+}
+
+func TestUseEgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		_, _ = fmt.Fprint(w, "Hello from ", r.URL.Path)
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	newTemplate := func(code string) *Template {
+		return MustNew(interp.Options{}, stdlib.Symbols).
+			MustUseEgress(EgressPolicy{Allow: []string{address}, MaxRequests: 2, Timeout: 100 * time.Millisecond}).
+			MustParseString(`<$ import "net/http" $><$ import "io/ioutil" $>` + code)
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		template := newTemplate(`<$ resp, err := http.Get(context + "/a"); if err != nil { panic(err) }; b, _ := ioutil.ReadAll(resp.Body); resp.Body.Close() $><$= string(b) $>`)
+		for i := 0; i < 3; i++ {
+			// the request limit is reset for every execution
+			var buf bytes.Buffer
+			template.MustExec(&buf, server.URL)
+			require.Equal(t, "Hello from /a", buf.String())
+		}
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		var buf bytes.Buffer
+		newTemplate(`<$ _, err := http.Get("http://10.0.0.1:8080/") $><$= err $>`).MustExec(&buf, nil)
+		require.Contains(t, buf.String(), "connection to 10.0.0.1:8080 is not allowed")
+	})
+
+	t.Run("request limit", func(t *testing.T) {
+		var buf bytes.Buffer
+		newTemplate(`<$ get := func() error { resp, err := http.Get(context); if err != nil { return err }; return resp.Body.Close() } $>
+<$- = get() $> <$= get() $> <$= get() $>`).
+			MustExec(&buf, server.URL)
+		// nil errors are written as empty strings
+		require.Equal(t, "  Get \""+server.URL+"\": the maximum of 2 requests was reached", buf.String())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		var buf bytes.Buffer
+		newTemplate(`<$ _, err := http.Get(context + "/slow") $><$= err != nil $>`).MustExec(&buf, server.URL)
+		require.Equal(t, "true", buf.String())
+	})
+
+	t.Run("no client", func(t *testing.T) {
+		_, err := newTemplate(`<$ c := &http.Client{} $><$= c $>`).Exec(&bytes.Buffer{}, nil)
+		require.Error(t, err)
+	})
+
+	t.Run("net", func(t *testing.T) {
+		var buf bytes.Buffer
+		MustNew(interp.Options{}, stdlib.Symbols).
+			MustUseEgress(EgressPolicy{Allow: []string{address}}).
+			MustParseString(`<$ import "net" $><$ c, err := net.Dial("tcp", context); if err == nil { c.Close() } $><$= err $>
+<$ _, err = net.Dial("tcp", "10.0.0.1:25") $><$= err $>`).
+			MustExec(&buf, address)
+		require.Equal(t, "\nconnection to 10.0.0.1:25 is not allowed", buf.String())
+	})
+}
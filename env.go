@@ -0,0 +1,292 @@
+package yaegi_template
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+// envPackages are the packages that are removed from the exports if a virtual environment is used,
+// because they pass the environment of the process to other processes.
+// os/exec is not part of stdlib.Symbols, but of github.com/traefik/yaegi/stdlib/unrestricted.
+var envPackages = []string{"os/exec/exec", "os/user/user"}
+
+// envRemovedSymbols are the symbols that are removed from the exports if a virtual environment is used,
+// because they read the environment of the process.
+// os.DirFS is removed because its files can not be checked by procFile.
+var envRemovedSymbols = map[string][]string{
+	"os/os":         {"StartProcess", "UserCacheDir", "UserConfigDir", "DirFS"},
+	"net/http/http": {"ProxyFromEnvironment"},
+}
+
+// UseEnv replaces the environment of the template with env, the environment of the process is hidden.
+// The environment functions of the os package (Getenv, LookupEnv, Environ, ExpandEnv, Setenv, Unsetenv, Clearenv,
+// UserHomeDir and TempDir) use env instead of the environment of the process. Packages and functions that pass the
+// environment to other processes or read it otherwise (e.g. os/exec, os/user and os.UserCacheDir) are removed.
+// The file functions of the standard library (os.Open, os.OpenFile, os.ReadFile and ioutil.ReadFile) refuse to open
+// files of /proc, because /proc/self/environ contains the environment the process was started with.
+// Other packages that read files by name (e.g. text/template.ParseFiles) are not covered, untrusted templates should
+// use a Sandbox with SafeSymbols() and SafePolicy().
+// Changes of the environment by the template (e.g. with os.Setenv) only last for one execution, env is not modified.
+// UseEnv must be called before parsing.
+//    template.MustUseEnv(map[string]string{
+//        "APP_ENV": "production",
+//    })
+// Note that DefaultOptions() passes GOPATH to the interpreter, it is used to find the source of imported packages,
+// but it is not visible to the template.
+func (t *Template) UseEnv(env map[string]string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.interp != nil {
+		return errors.New("the environment must be set before the template gets parsed")
+	}
+	t.env = newEnvironment(env)
+	return nil
+}
+
+// MustUseEnv is like UseEnv, except it panics on failure.
+func (t *Template) MustUseEnv(env map[string]string) *Template {
+	if err := t.UseEnv(env); err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// environment is the virtual environment of a template.
+type environment struct {
+	initial map[string]string
+
+	mu   sync.RWMutex
+	vars map[string]string
+}
+
+func newEnvironment(env map[string]string) *environment {
+	e := &environment{initial: make(map[string]string, len(env))}
+	for key, value := range env {
+		e.initial[key] = value
+	}
+	e.reset()
+	return e
+}
+
+// reset restores the initial environment, it is called before every execution.
+func (e *environment) reset() {
+	vars := make(map[string]string, len(e.initial))
+	for key, value := range e.initial {
+		vars[key] = value
+	}
+	e.mu.Lock()
+	e.vars = vars
+	e.mu.Unlock()
+}
+
+func (e *environment) Getenv(key string) string {
+	value, _ := e.LookupEnv(key)
+	return value
+}
+
+func (e *environment) LookupEnv(key string) (string, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	value, ok := e.vars[key]
+	return value, ok
+}
+
+func (e *environment) Environ() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	result := make([]string, 0, len(e.vars))
+	for key, value := range e.vars {
+		result = append(result, key+"="+value)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (e *environment) ExpandEnv(s string) string {
+	return os.Expand(s, e.Getenv)
+}
+
+func (e *environment) Setenv(key, value string) error {
+	if key == "" {
+		return &os.SyscallError{Syscall: "setenv", Err: syscall.EINVAL}
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] == '=' || key[i] == 0 {
+			return &os.SyscallError{Syscall: "setenv", Err: syscall.EINVAL}
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.vars[key] = value
+	return nil
+}
+
+func (e *environment) Unsetenv(key string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.vars, key)
+	return nil
+}
+
+func (e *environment) Clearenv() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.vars = make(map[string]string)
+}
+
+func (e *environment) UserHomeDir() (string, error) {
+	if home := e.Getenv("HOME"); home != "" {
+		return home, nil
+	}
+	return "", errors.New("$HOME is not defined")
+}
+
+func (e *environment) TempDir() string {
+	if dir := e.Getenv("TMPDIR"); dir != "" {
+		return dir
+	}
+	return "/tmp"
+}
+
+// replace returns the exports with the environment functions replaced by the virtual ones.
+// The os package is only changed if it is part of the exports.
+func (e *environment) replace(exports interp.Exports) interp.Exports {
+	result := make(interp.Exports, len(exports))
+	for key, symbols := range exports {
+		result[key] = symbols
+	}
+	for _, key := range envPackages {
+		delete(result, key)
+	}
+	for key, names := range envRemovedSymbols {
+		symbols, ok := result[key]
+		if !ok {
+			continue
+		}
+		filtered := make(map[string]reflect.Value, len(symbols))
+		for name, value := range symbols {
+			filtered[name] = value
+		}
+		for _, name := range names {
+			delete(filtered, name)
+		}
+		result[key] = filtered
+	}
+	for key, replaced := range e.symbols() {
+		symbols, ok := result[key]
+		if !ok {
+			continue
+		}
+		copied := make(map[string]reflect.Value, len(symbols))
+		for name, value := range symbols {
+			copied[name] = value
+		}
+		for name, value := range replaced {
+			if key == "os/os" && envFunctions[name] {
+				copied[name] = value
+				continue
+			}
+			// only the file functions of the standard library are replaced, a Sandbox can not open /proc anyway
+			if original, ok := copied[name]; ok && isStdlibSymbol(key, name, original) {
+				copied[name] = value
+			}
+		}
+		result[key] = copied
+	}
+	return result
+}
+
+// envFunctions are the environment functions of the os package that are always replaced.
+var envFunctions = map[string]bool{
+	"Getenv":      true,
+	"LookupEnv":   true,
+	"Environ":     true,
+	"ExpandEnv":   true,
+	"Setenv":      true,
+	"Unsetenv":    true,
+	"Clearenv":    true,
+	"UserHomeDir": true,
+	"TempDir":     true,
+}
+
+// isStdlibSymbol reports whether value is the symbol name of the package key in stdlib.Symbols.
+func isStdlibSymbol(key, name string, value reflect.Value) bool {
+	symbol, ok := stdlib.Symbols[key][name]
+	if !ok || !value.IsValid() || value.Kind() != reflect.Func || symbol.Kind() != reflect.Func {
+		return false
+	}
+	return value.Pointer() == symbol.Pointer()
+}
+
+// symbols returns the virtual environment functions of the os package and the file functions that refuse to open
+// files of /proc.
+func (e *environment) symbols() map[string]map[string]reflect.Value {
+	return map[string]map[string]reflect.Value{
+		"os/os": {
+			"Getenv":      reflect.ValueOf(e.Getenv),
+			"LookupEnv":   reflect.ValueOf(e.LookupEnv),
+			"Environ":     reflect.ValueOf(e.Environ),
+			"ExpandEnv":   reflect.ValueOf(e.ExpandEnv),
+			"Setenv":      reflect.ValueOf(e.Setenv),
+			"Unsetenv":    reflect.ValueOf(e.Unsetenv),
+			"Clearenv":    reflect.ValueOf(e.Clearenv),
+			"UserHomeDir": reflect.ValueOf(e.UserHomeDir),
+			"TempDir":     reflect.ValueOf(e.TempDir),
+			"Open":        reflect.ValueOf(envOpen),
+			"OpenFile":    reflect.ValueOf(envOpenFile),
+			"ReadFile":    reflect.ValueOf(envReadFile),
+		},
+		"io/ioutil/ioutil": {
+			"ReadFile": reflect.ValueOf(envReadFile),
+		},
+	}
+}
+
+// envOpen is like os.Open, except it refuses to open files of /proc.
+func envOpen(name string) (*os.File, error) {
+	return envOpenFile(name, os.O_RDONLY, 0)
+}
+
+// envOpenFile is like os.OpenFile, except it refuses to open files of /proc.
+// The opened file is checked instead of name, so links and relative paths can not be used to get around the check.
+func envOpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if procFile(f) {
+		_ = f.Close()
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	return f, nil
+}
+
+// envReadFile is like ioutil.ReadFile, except it refuses to read files of /proc.
+func envReadFile(name string) ([]byte, error) {
+	f, err := envOpen(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// procFile reports whether f is a file of /proc.
+// If /proc/self/fd is not available there is no /proc that could reveal the environment.
+func procFile(f *os.File) bool {
+	path, err := os.Readlink("/proc/self/fd/" + strconv.FormatUint(uint64(f.Fd()), 10))
+	if err != nil {
+		return false
+	}
+	return path == "/proc" || strings.HasPrefix(path, "/proc/")
+}
@@ -0,0 +1,109 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+func TestUseEnv(t *testing.T) {
+	require.NoError(t, os.Setenv("YAEGI_TEMPLATE_SECRET", "secret"))
+	defer os.Unsetenv("YAEGI_TEMPLATE_SECRET")
+
+	newTemplate := func(code string) *Template {
+		return MustNew(interp.Options{}, stdlib.Symbols).
+			MustUseEnv(map[string]string{"APP_ENV": "production", "HOME": "/home/app"}).
+			MustParseString(`<$ import "os" $>` + code)
+	}
+
+	t.Run("Getenv", func(t *testing.T) {
+		template := newTemplate(`<$= os.Getenv("APP_ENV") $>|<$= os.Getenv("YAEGI_TEMPLATE_SECRET") $>|<$= os.ExpandEnv("$HOME/.config") $>`)
+		var buf bytes.Buffer
+		_, err := template.Exec(&buf, nil)
+		require.NoError(t, err)
+		require.Equal(t, "production||/home/app/.config", buf.String())
+	})
+
+	t.Run("Environ", func(t *testing.T) {
+		template := newTemplate(`<$= os.Environ() $>`)
+		var buf bytes.Buffer
+		_, err := template.Exec(&buf, nil)
+		require.NoError(t, err)
+		require.Equal(t, "[APP_ENV=production HOME=/home/app]", buf.String())
+	})
+
+	t.Run("Setenv", func(t *testing.T) {
+		template := newTemplate(`<$ _, ok := os.LookupEnv("NEW") $><$= ok $><$ os.Setenv("NEW", "value"); os.Unsetenv("APP_ENV") $>|<$= os.Getenv("NEW") $><$= os.Getenv("APP_ENV") $>`)
+		for i := 0; i < 2; i++ {
+			// changes only last for one execution
+			var buf bytes.Buffer
+			_, err := template.Exec(&buf, nil)
+			require.NoError(t, err)
+			require.Equal(t, "false|value", buf.String())
+		}
+		_, ok := os.LookupEnv("NEW")
+		require.False(t, ok)
+	})
+
+	t.Run("os/exec is removed", func(t *testing.T) {
+		// os/exec is only part of the unrestricted symbols of yaegi
+		unrestricted := interp.Exports{
+			"os/exec/exec": {"Command": reflect.ValueOf(exec.Command)},
+		}
+		code := `<$ import "os/exec" $><$= exec.Command("true").Run() == nil $>`
+		var buf bytes.Buffer
+		_, err := MustNew(interp.Options{}, stdlib.Symbols, unrestricted).MustParseString(code).Exec(&buf, nil)
+		require.NoError(t, err)
+		require.Equal(t, "true", buf.String())
+
+		_, err = MustNew(interp.Options{}, stdlib.Symbols, unrestricted).
+			MustUseEnv(nil).
+			MustParseString(code).
+			Exec(&bytes.Buffer{}, nil)
+		require.Error(t, err)
+	})
+
+	t.Run("proc is not readable", func(t *testing.T) {
+		if _, err := os.Stat("/proc/self/environ"); err != nil {
+			t.Skip("/proc/self/environ is not available")
+		}
+		link := filepath.Join(t.TempDir(), "environ")
+		require.NoError(t, os.Symlink("/proc/self/environ", link))
+		for _, code := range []string{
+			`<$ b, err := os.ReadFile("/proc/self/environ") $><$= string(b) $><$= err != nil $>`,
+			`<$ import "io/ioutil" $><$ b, err := ioutil.ReadFile("/proc/1/../self/environ") $><$= string(b) $><$= err != nil $>`,
+			`<$ f, err := os.Open("` + link + `") $><$= f == nil $><$= err != nil $>`,
+			`<$ f, err := os.OpenFile("/proc/self/environ", os.O_RDONLY, 0) $><$= f == nil $><$= err != nil $>`,
+		} {
+			template := newTemplate(code)
+			var buf bytes.Buffer
+			_, err := template.Exec(&buf, nil)
+			require.NoError(t, err, code)
+			require.NotContains(t, buf.String(), "YAEGI_TEMPLATE_SECRET", code)
+			require.True(t, strings.HasSuffix(buf.String(), "true"), code)
+		}
+
+		// other files can still be read
+		file := filepath.Join(filepath.Dir(link), "file")
+		require.NoError(t, ioutil.WriteFile(file, []byte("content"), 0600))
+		template := newTemplate(`<$ b, _ := os.ReadFile("` + file + `") $><$= string(b) $>`)
+		var buf bytes.Buffer
+		_, err := template.Exec(&buf, nil)
+		require.NoError(t, err)
+		require.Equal(t, "content", buf.String())
+	})
+
+	t.Run("after parse", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).MustParseString(`Hello`)
+		require.Error(t, template.UseEnv(nil))
+	})
+}
@@ -0,0 +1,443 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Escaper escapes the output of the code blocks.
+// The literal text parts of the template are passed to Text, so the escaper can keep track of the context
+// the output is written to. Everything the code blocks write is passed to Escape.
+type Escaper interface {
+	// Reset is called before each execution of the template.
+	Reset()
+	// Text is called with the literal text parts of the template, they are written unescaped.
+	Text(p []byte)
+	// Escape returns the escaped version of p.
+	Escape(p []byte) []byte
+}
+
+// valueEscaper is implemented by escapers that handle the values of expression blocks differently,
+// e.g. to let trusted types (like SafeHTML) pass.
+// formatted is the string representation of v.
+type valueEscaper interface {
+	escapeValue(v reflect.Value, formatted string) []byte
+}
+
+// NewEscaper returns the built-in escaper for the specified format.
+// Supported formats are html, xml, json, sh and csv, the format can also be a file extension (e.g. ".html").
+func NewEscaper(format string) (Escaper, error) {
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "html", "htm":
+		return NewHTMLEscaper(), nil
+	case "xml":
+		return NewXMLEscaper(), nil
+	case "json":
+		return NewJSONEscaper(), nil
+	case "sh", "shell", "bash":
+		return NewShellEscaper(), nil
+	case "csv":
+		return NewCSVEscaper(), nil
+	}
+	return nil, errors.Errorf("unknown escaper format %q", format)
+}
+
+// EscaperForFile returns the built-in escaper for the extension of the specified file name,
+// nil is returned if there is no escaper for the extension.
+func EscaperForFile(name string) Escaper {
+	ext := filepath.Ext(name)
+	if ext == "" {
+		return nil
+	}
+	e, err := NewEscaper(ext)
+	if err != nil {
+		return nil
+	}
+	return e
+}
+
+// rawValue is a value that should be written without escaping, see raw().
+type rawValue struct {
+	v interface{}
+}
+
+// raw marks a value, so it will be written without escaping by an expression block or an implicit return.
+func raw(v interface{}) rawValue {
+	return rawValue{v: v}
+}
+
+// XMLEscaper is an Escaper that escapes the output for xml documents.
+type XMLEscaper struct{}
+
+// NewXMLEscaper creates a new XMLEscaper.
+func NewXMLEscaper() *XMLEscaper {
+	return &XMLEscaper{}
+}
+
+// Reset does nothing, the XMLEscaper has no state.
+func (*XMLEscaper) Reset() {}
+
+// Text does nothing, the XMLEscaper escapes all output the same way.
+func (*XMLEscaper) Text([]byte) {}
+
+// Escape escapes the special xml characters in p.
+func (*XMLEscaper) Escape(p []byte) []byte {
+	var buf bytes.Buffer
+	if err := xml.EscapeText(&buf, p); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// JSONEscaper is an Escaper for json documents.
+// Output inside of a json string gets escaped for the string, all other output is written as a json value:
+//    {"name": "<$= context.Name $>", "tags": <$= context.Tags $>}
+type JSONEscaper struct {
+	quoted  bool
+	escaped bool
+}
+
+// NewJSONEscaper creates a new JSONEscaper.
+func NewJSONEscaper() *JSONEscaper {
+	return &JSONEscaper{}
+}
+
+// Reset resets the escaper, so the output is outside of a json string.
+func (e *JSONEscaper) Reset() {
+	*e = JSONEscaper{}
+}
+
+// Text keeps track of the json strings in p.
+func (e *JSONEscaper) Text(p []byte) {
+	for _, c := range p {
+		switch {
+		case e.escaped:
+			e.escaped = false
+		case e.quoted && c == '\\':
+			e.escaped = true
+		case c == '"':
+			e.quoted = !e.quoted
+		}
+	}
+}
+
+// Escape escapes p as a json string, the quotes are omitted when the output is inside of a json string.
+func (e *JSONEscaper) Escape(p []byte) []byte {
+	b, err := marshalJSON(string(p))
+	if err != nil {
+		return nil
+	}
+	if e.quoted {
+		return b[1 : len(b)-1]
+	}
+	return b
+}
+
+func (e *JSONEscaper) escapeValue(v reflect.Value, formatted string) []byte {
+	if e.quoted || !v.IsValid() || !v.CanInterface() {
+		return e.Escape([]byte(formatted))
+	}
+	b, err := marshalJSON(v.Interface())
+	if err != nil {
+		return []byte("null")
+	}
+	return b
+}
+
+// marshalJSON is like json.Marshal, except it does not escape html characters.
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// ShellEscaper is an Escaper for shell (sh, bash) scripts.
+// Output outside of quotes gets single quoted, output inside of quotes gets escaped for the quotes:
+//    echo <$= context.Name $> "Hello <$= context.Name $>"
+// Comments and here-documents are tracked as well: output inside of a comment can not start a new line and output
+// inside of a here-document can neither end it nor (for unquoted delimiters) expand variables or commands.
+type ShellEscaper struct {
+	quote   byte
+	escaped bool
+	// prev is the previous character outside of quotes, it is used to find the start of comments and heredocs.
+	prev    byte
+	comment bool
+	// delimiter is the delimiter of a heredoc that is being read (after <<).
+	delimiter *shellDelimiter
+	// heredocs are the heredocs that start on the next line.
+	heredocs []shellHeredoc
+	// heredoc is the heredoc whose body is written, nil outside of a heredoc.
+	heredoc *shellHeredoc
+	// line is the current line of the heredoc body.
+	line []byte
+}
+
+type shellHeredoc struct {
+	delimiter string
+	// quoted is true if the delimiter was quoted, so the body is not expanded.
+	quoted bool
+	// stripTabs is true for <<-, the leading tabs of the lines are ignored.
+	stripTabs bool
+}
+
+// shellDelimiter is the state of reading a heredoc delimiter.
+type shellDelimiter struct {
+	shellHeredoc
+	word    []byte
+	n       int
+	quote   byte
+	escaped bool
+}
+
+// NewShellEscaper creates a new ShellEscaper.
+func NewShellEscaper() *ShellEscaper {
+	return &ShellEscaper{}
+}
+
+// Reset resets the escaper, so the output is outside of quotes.
+func (e *ShellEscaper) Reset() {
+	*e = ShellEscaper{}
+}
+
+// Text keeps track of the quotes, comments and heredocs in p.
+func (e *ShellEscaper) Text(p []byte) {
+	for _, c := range p {
+		e.next(c)
+	}
+}
+
+func (e *ShellEscaper) next(c byte) {
+	switch {
+	case e.heredoc != nil:
+		e.nextHeredoc(c)
+		return
+	case e.comment:
+		if c == '\n' {
+			e.comment = false
+			e.prev = c
+			e.newline()
+		}
+		return
+	case e.delimiter != nil:
+		if e.nextDelimiter(c) {
+			return
+		}
+	}
+
+	switch {
+	case e.escaped:
+		e.escaped = false
+	case e.quote != '\'' && c == '\\':
+		e.escaped = true
+	case e.quote != 0:
+		if c == e.quote {
+			e.quote = 0
+		}
+	case c == '\'' || c == '"':
+		e.quote = c
+	case c == '#' && isShellWordStart(e.prev):
+		e.comment = true
+	case c == '<' && e.prev == '<':
+		e.delimiter = &shellDelimiter{}
+		// <<< is no heredoc
+		c = 0
+	case c == '\n':
+		e.newline()
+	}
+	if e.quote == 0 {
+		e.prev = c
+	}
+}
+
+// nextDelimiter reads the heredoc delimiter, it returns false if c does not belong to the delimiter.
+func (e *ShellEscaper) nextDelimiter(c byte) bool {
+	d := e.delimiter
+	d.n++
+	switch {
+	case d.escaped:
+		d.escaped = false
+		d.word = append(d.word, c)
+	case d.quote != 0:
+		if c == d.quote {
+			d.quote = 0
+		} else {
+			d.word = append(d.word, c)
+		}
+	case c == '\\':
+		d.escaped = true
+		d.quoted = true
+	case c == '\'' || c == '"':
+		d.quote = c
+		d.quoted = true
+	case d.n == 1 && c == '<':
+		// here-string
+		e.delimiter = nil
+	case d.n == 1 && c == '-':
+		d.stripTabs = true
+	case c == ' ' || c == '\t':
+		if len(d.word) > 0 || d.quoted {
+			e.endDelimiter()
+		}
+	case isASCIILetter(c) || isASCIIDigit(c) || c == '_':
+		d.word = append(d.word, c)
+	default:
+		// e.g. a newline or ;
+		e.endDelimiter()
+		return false
+	}
+	return true
+}
+
+func (e *ShellEscaper) endDelimiter() {
+	d := e.delimiter
+	e.delimiter = nil
+	// delimiters are words, this ignores shifts like $((1<<2))
+	if len(d.word) == 0 || isASCIIDigit(d.word[0]) {
+		return
+	}
+	d.delimiter = string(d.word)
+	e.heredocs = append(e.heredocs, d.shellHeredoc)
+}
+
+// newline starts the body of the next heredoc.
+func (e *ShellEscaper) newline() {
+	if e.delimiter != nil {
+		e.endDelimiter()
+	}
+	if len(e.heredocs) == 0 {
+		return
+	}
+	e.heredoc = &e.heredocs[0]
+	e.heredocs = e.heredocs[1:]
+	e.line = e.line[:0]
+}
+
+func (e *ShellEscaper) nextHeredoc(c byte) {
+	if c != '\n' {
+		e.line = append(e.line, c)
+		return
+	}
+	if e.heredoc.isDelimiter(e.line) {
+		e.heredoc = nil
+		e.prev = c
+		e.newline()
+		return
+	}
+	e.line = e.line[:0]
+}
+
+func (h *shellHeredoc) isDelimiter(line []byte) bool {
+	if h.stripTabs {
+		line = bytes.TrimLeft(line, "\t")
+	}
+	return string(line) == h.delimiter
+}
+
+func isShellWordStart(prev byte) bool {
+	switch prev {
+	case 0, ' ', '\t', '\n', ';', '&', '|', '(', ')':
+		return true
+	}
+	return false
+}
+
+// Escape escapes p for the current quoting.
+func (e *ShellEscaper) Escape(p []byte) []byte {
+	switch {
+	case e.heredoc != nil:
+		return e.escapeHeredoc(p)
+	case e.comment:
+		// the output must not end the comment
+		return bytes.Map(func(r rune) rune {
+			if r == '\n' || r == '\r' {
+				return ' '
+			}
+			return r
+		}, p)
+	}
+	switch e.quote {
+	case '\'':
+		return bytes.ReplaceAll(p, []byte("'"), []byte(`'\''`))
+	case '"':
+		var buf bytes.Buffer
+		for _, c := range p {
+			if c == '\\' || c == '"' || c == '$' || c == '`' {
+				buf.WriteByte('\\')
+			}
+			buf.WriteByte(c)
+		}
+		return buf.Bytes()
+	}
+	return []byte("'" + strings.ReplaceAll(string(p), "'", `'\''`) + "'")
+}
+
+// escapeHeredoc escapes p for the body of the heredoc: lines that would end the heredoc get indented by a space and,
+// if the delimiter was not quoted, \, $ and ` get escaped.
+func (e *ShellEscaper) escapeHeredoc(p []byte) []byte {
+	var buf bytes.Buffer
+	lines := bytes.Split(p, []byte("\n"))
+	for i, line := range lines {
+		if i > 0 {
+			buf.WriteByte('\n')
+			e.line = e.line[:0]
+		}
+		if len(e.line) == 0 && e.heredoc.isDelimiter(line) {
+			buf.WriteByte(' ')
+			e.line = append(e.line, ' ')
+		}
+		start := buf.Len()
+		for _, c := range line {
+			if !e.heredoc.quoted && (c == '\\' || c == '$' || c == '`') {
+				buf.WriteByte('\\')
+			}
+			buf.WriteByte(c)
+		}
+		e.line = append(e.line, buf.Bytes()[start:]...)
+	}
+	return buf.Bytes()
+}
+
+// CSVEscaper is an Escaper for csv files.
+// Output outside of a quoted field gets quoted if necessary, output inside of a quoted field gets its quotes doubled.
+type CSVEscaper struct {
+	quoted bool
+}
+
+// NewCSVEscaper creates a new CSVEscaper.
+func NewCSVEscaper() *CSVEscaper {
+	return &CSVEscaper{}
+}
+
+// Reset resets the escaper, so the output is outside of a quoted field.
+func (e *CSVEscaper) Reset() {
+	*e = CSVEscaper{}
+}
+
+// Text keeps track of the quoted fields in p.
+func (e *CSVEscaper) Text(p []byte) {
+	for _, c := range p {
+		if c == '"' {
+			// a doubled quote inside of a quoted field toggles twice
+			e.quoted = !e.quoted
+		}
+	}
+}
+
+// Escape escapes p as a csv field.
+func (e *CSVEscaper) Escape(p []byte) []byte {
+	escaped := bytes.ReplaceAll(p, []byte(`"`), []byte(`""`))
+	if e.quoted || (!bytes.ContainsAny(p, "\",\r\n") && len(bytes.TrimSpace(p)) == len(p)) {
+		return escaped
+	}
+	return []byte(`"` + string(escaped) + `"`)
+}
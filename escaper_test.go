@@ -0,0 +1,122 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+func TestEscaper(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Format   string
+		Template string
+		Expect   string
+	}{
+		{
+			"XML",
+			"xml",
+			`<name attr="<$= context $>"><$= context $></name>`,
+			`<name attr="Tom &amp; &#34;Jerry&#34; &lt;&#39;s&#39;&gt;">Tom &amp; &#34;Jerry&#34; &lt;&#39;s&#39;&gt;</name>`,
+		},
+		{
+			"JSON string",
+			"json",
+			`{"name": "<$= context $>"}`,
+			`{"name": "Tom & \"Jerry\" <'s'>"}`,
+		},
+		{
+			"JSON value",
+			"json",
+			`{"name": <$= context $>, "age": <$= 42 $>, "escaped": "\"<$= "x" $>"}`,
+			`{"name": "Tom & \"Jerry\" <'s'>", "age": 42, "escaped": "\"x"}`,
+		},
+		{
+			"Shell",
+			"sh",
+			`echo <$= context $> "<$= context $>" '<$= context $>'`,
+			`echo 'Tom & "Jerry" <'\''s'\''>' "Tom & \"Jerry\" <'s'>" 'Tom & "Jerry" <'\''s'\''>'`,
+		},
+		{
+			"Shell print",
+			"sh",
+			`echo <$ print("$(rm -rf /)") $>`,
+			`echo '$(rm -rf /)'`,
+		},
+		{
+			"Shell comment",
+			"sh",
+			"#!/bin/sh\n# don't edit\necho <$= context $> # <$= \"a\\nrm -rf ~\" $>\necho <$= \"x; y\" $>",
+			"#!/bin/sh\n# don't edit\necho 'Tom & \"Jerry\" <'\\''s'\\''>' # a rm -rf ~\necho 'x; y'",
+		},
+		{
+			"Shell heredoc",
+			"sh",
+			"cat <<EOF > out\nit's <$= \"$(id)\\nEOF\\nrm -rf ~\" $>\nEOF\necho <$= \"x; y\" $>",
+			"cat <<EOF > out\nit's \\$(id)\n EOF\nrm -rf ~\nEOF\necho 'x; y'",
+		},
+		{
+			"Shell quoted heredoc",
+			"sh",
+			"cat <<-'EOF'\n\t<$= \"$HOME\" $>\n\tEOF\necho $((1<<2)) <$= \"x; y\" $> <<< <$= \"z\" $>",
+			"cat <<-'EOF'\n\t$HOME\n\tEOF\necho $((1<<2)) 'x; y' <<< 'z'",
+		},
+		{
+			"CSV",
+			"csv",
+			`<$= "a" $>,<$= context $>,"<$= context $>",<$= " b" $>`,
+			`a,"Tom & ""Jerry"" <'s'>","Tom & ""Jerry"" <'s'>"," b"`,
+		},
+		{
+			"Raw",
+			".html",
+			`<p><$= raw("<b>") $><$= "<b>" $></p>`,
+			`<p><b>&lt;b&gt;</p>`,
+		},
+		{
+			"Raw implicit return",
+			"xml",
+			`<$ raw(context) $>`,
+			`Tom & "Jerry" <'s'>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			escaper, err := NewEscaper(test.Format)
+			require.NoError(t, err)
+			template := MustNew(interp.Options{}, stdlib.Symbols)
+			template.Escaper = escaper
+			template.MustParseString(test.Template)
+
+			var buf bytes.Buffer
+			template.MustExec(&buf, `Tom & "Jerry" <'s'>`)
+			require.Equal(t, test.Expect, buf.String())
+		})
+	}
+}
+
+func TestNewEscaper(t *testing.T) {
+	_, err := NewEscaper("yaml")
+	require.EqualError(t, err, `unknown escaper format "yaml"`)
+
+	require.IsType(t, &HTMLEscaper{}, EscaperForFile("index.html"))
+	require.IsType(t, &XMLEscaper{}, EscaperForFile("feed.XML"))
+	require.IsType(t, &JSONEscaper{}, EscaperForFile("data.json"))
+	require.IsType(t, &ShellEscaper{}, EscaperForFile("install.sh"))
+	require.IsType(t, &CSVEscaper{}, EscaperForFile("/tmp/report.csv"))
+	require.Nil(t, EscaperForFile("README.md"))
+	require.Nil(t, EscaperForFile("Makefile"))
+}
+
+func TestRaw(t *testing.T) {
+	template := MustNew(interp.Options{}, stdlib.Symbols).
+		MustParseString(`<$= raw("<b>") $>`)
+
+	var buf bytes.Buffer
+	template.MustExec(&buf, nil)
+	require.Equal(t, "<b>", buf.String())
+}
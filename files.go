@@ -0,0 +1,251 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FileSink receives the files of a template that was executed with ExecFilesTo().
+type FileSink interface {
+	// WriteFile writes a file, name is a clean relative slash separated path.
+	WriteFile(name string, data []byte) error
+}
+
+// MapSink is a FileSink that collects the files in a map.
+type MapSink map[string][]byte
+
+// WriteFile stores the file in the map.
+func (m MapSink) WriteFile(name string, data []byte) error {
+	if err := validateFileName(name); err != nil {
+		return err
+	}
+	m[name] = data
+	return nil
+}
+
+// DirSink returns a FileSink that writes the files into the directory dir, missing directories are created.
+// Files can not be written outside of dir, links inside of dir that lead outside of it are refused.
+func DirSink(dir string) FileSink {
+	return dirSink(dir)
+}
+
+type dirSink string
+
+func (d dirSink) WriteFile(name string, data []byte) error {
+	if err := validateFileName(name); err != nil {
+		return err
+	}
+	root, err := filepath.Abs(string(d))
+	if err != nil {
+		return errors.Wrapf(err, "unable to resolve directory %q", string(d))
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return errors.Wrapf(err, "unable to create directory %q", string(d))
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return errors.Wrapf(err, "unable to resolve directory %q", string(d))
+	}
+	// links inside of the directory must not lead outside of it
+	p, err := resolveInRoot(root, filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		return errors.Wrapf(err, "file path %q is outside of %q", name, string(d))
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return errors.Wrapf(err, "unable to create directory for %q", name)
+	}
+	if err := ioutil.WriteFile(p, data, 0644); err != nil { //nolint:gosec // generated files are not secret
+		return errors.Wrapf(err, "unable to write %q", name)
+	}
+	return nil
+}
+
+// resolveInRoot resolves the links of the path p, that is inside of the resolved directory root.
+// The deepest existing element of p gets resolved, the remaining elements do not exist and can not be links.
+// os.ErrPermission is returned if the resolved path is outside of root or if the deepest existing element is a
+// dangling link, that could be created outside of root.
+func resolveInRoot(root, p string) (string, error) {
+	existing, rest := p, ""
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+				return "", os.ErrPermission
+			}
+			return filepath.Join(resolved, rest), nil
+		}
+		if !os.IsNotExist(err) || existing == root {
+			return "", err
+		}
+		if _, err := os.Lstat(existing); err == nil {
+			// a dangling link
+			return "", os.ErrPermission
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = filepath.Dir(existing)
+	}
+}
+
+// validateFileName returns an error if name is not a clean relative slash separated path,
+// that stays inside of the output directory.
+func validateFileName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("file path is empty")
+	case strings.ContainsAny(name, "\\\x00") || isDriveLetter(name):
+		return errors.Errorf("file path %q contains invalid characters", name)
+	case path.IsAbs(name):
+		return errors.Errorf("file path %q must be relative", name)
+	case path.Clean(name) != name || name == "." || name == ".." || strings.HasPrefix(name, "../"):
+		return errors.Errorf("file path %q must be clean and must not leave the output directory", name)
+	}
+	return nil
+}
+
+// isDriveLetter returns true if name starts with a windows drive letter (e.g. C:), that would make it absolute.
+func isDriveLetter(name string) bool {
+	return len(name) >= 2 && name[1] == ':' && isASCIILetter(name[0])
+}
+
+// ExecFiles executes the template and returns the files that were written.
+// Inside the template file() switches the output to another file, writing to the same file again appends to it:
+//    <$ for _, name := range context.Handlers { $>
+//    <$ file("handlers/" + name + ".go") $>package handlers
+//    ...
+//    <$ } $>
+// Output before the first call to file() must only consist of whitespace.
+// Output filters and GoOutput (for .go files) are applied to every file.
+func (t *Template) ExecFiles(context interface{}) (map[string][]byte, error) {
+	files := make(MapSink)
+	if err := t.ExecFilesTo(files, context); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// MustExecFiles is like ExecFiles, except it panics on failure.
+func (t *Template) MustExecFiles(context interface{}) map[string][]byte {
+	files, err := t.ExecFiles(context)
+	if err != nil {
+		panic(err.Error())
+	}
+	return files
+}
+
+// ExecFilesTo is like ExecFiles, but writes the files into sink.
+// The files are written in lexical order, after the template was executed successfully.
+//    err := template.ExecFilesTo(yaegi_template.DirSink("out"), context)
+func (t *Template) ExecFilesTo(sink FileSink, context interface{}) (err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.codeBuffer == nil {
+		return errors.New("template was never parsed")
+	}
+
+	end := t.traceExecution()
+	defer func() {
+		end(err)
+	}()
+
+	var prog program
+	if err := t.compile(&prog); err != nil {
+		return err
+	}
+
+	t.outputBuffer.allowFiles = true
+	_, err = t.execCode(&prog, context, func() (int, error) {
+		files, err := t.splitFiles(&prog)
+		if err != nil {
+			return 0, err
+		}
+		names := make([]string, 0, len(files))
+		for name := range files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := sink.WriteFile(name, files[name]); err != nil {
+				return 0, errors.Wrapf(err, "unable to write file %q", name)
+			}
+		}
+		return 0, nil
+	})
+	return err
+}
+
+// splitFiles splits the output buffer into the files and applies the output formatting and filters to them.
+func (t *Template) splitFiles(prog *program) (map[string][]byte, error) {
+	ob := t.outputBuffer
+	output := ob.Bytes()
+	start := len(output)
+	if len(ob.files) > 0 {
+		start = ob.files[0].offset
+	}
+	if len(bytes.TrimSpace(output[:start])) > 0 {
+		return nil, errors.New("output outside of a file, use file() before writing")
+	}
+
+	contents := make(map[string][]byte)
+	segments := make(map[string][]outputSegment)
+	for i, f := range ob.files {
+		end := len(output)
+		if i+1 < len(ob.files) {
+			end = ob.files[i+1].offset
+		}
+		// writing to the same file again appends to it
+		for _, seg := range sliceSegments(ob.segments, f.offset, end) {
+			seg.offset += len(contents[f.name])
+			segments[f.name] = append(segments[f.name], seg)
+		}
+		contents[f.name] = append(contents[f.name], output[f.offset:end]...)
+	}
+
+	if t.GoOutput {
+		for name, content := range contents {
+			if !strings.HasSuffix(name, ".go") {
+				continue
+			}
+			formatted, err := formatGoOutput(prog, segments[name], content)
+			if err != nil {
+				return nil, errors.Wrapf(err, "file %q", name)
+			}
+			contents[name] = formatted
+		}
+	}
+
+	files := make(map[string][]byte, len(contents))
+	for name, content := range contents {
+		var buf bytes.Buffer
+		if _, err := t.writeOutput(&buf, content); err != nil {
+			return nil, errors.Wrapf(err, "file %q", name)
+		}
+		files[name] = buf.Bytes()
+	}
+	return files, nil
+}
+
+// sliceSegments returns the segments of the output between start and end, with offsets relative to start.
+func sliceSegments(segments []outputSegment, start, end int) []outputSegment {
+	var result []outputSegment
+	for i, seg := range segments {
+		if seg.offset >= end {
+			break
+		}
+		if seg.offset < start {
+			if i+1 < len(segments) && segments[i+1].offset <= start {
+				continue
+			}
+			// the segment started before the file, this can only be a code segment
+			seg.offset = start
+		}
+		seg.offset -= start
+		result = append(result, seg)
+	}
+	return result
+}
@@ -0,0 +1,118 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+func TestExecFiles(t *testing.T) {
+	t.Run("Files", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols)
+		template.MustParseString(`
+<$ for _, name := range context { $>
+<$ file("handlers/" + name + ".go") $>package handlers // <$= name $>
+<$ file("index.txt") $><$= name $>
+<$ } $>`)
+
+		files := template.MustExecFiles([]string{"user", "post"})
+		require.Equal(t, map[string][]byte{
+			"handlers/user.go": []byte("package handlers // user\n"),
+			"handlers/post.go": []byte("package handlers // post\n"),
+			"index.txt":        []byte("user\n\npost\n"),
+		}, files)
+	})
+
+	t.Run("GoOutput and escaper", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols)
+		template.GoOutput = true
+		template.Escaper = EscaperForFile("index.html")
+		template.MustParseString(`<$ file("main.go") $>package main
+func main() { fmt.Println(<$= "1" $>) }
+<$ file("index.html") $><a title="<$= context $>"><$= context $></a>`)
+
+		files := template.MustExecFiles(`"<b>"`)
+		require.Equal(t, map[string][]byte{
+			"main.go":    []byte("package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(1) }\n"),
+			"index.html": []byte(`<a title="&#34;&lt;b&gt;&#34;">&#34;&lt;b&gt;&#34;</a>`),
+		}, files)
+	})
+
+	t.Run("Output outside of a file", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols)
+		template.MustParseString(`Hello<$ file("a.txt") $>`)
+		_, err := template.ExecFiles(nil)
+		require.EqualError(t, err, "output outside of a file, use file() before writing")
+	})
+
+	t.Run("Exec", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols)
+		template.MustParseString(`<$ file("a.txt") $>`)
+		_, err := template.Exec(&bytes.Buffer{}, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "file() can only be used with ExecFiles() or ExecFilesTo()")
+	})
+
+	t.Run("Path traversal", func(t *testing.T) {
+		for _, name := range []string{"", "../a", "a/../../b", "/etc/passwd", "a/./b", `a\b`, "C:a", "."} {
+			template := MustNew(interp.Options{}, stdlib.Symbols)
+			template.MustParseString(`<$ file(context) $>`)
+			_, err := template.ExecFiles(name)
+			require.Error(t, err, name)
+		}
+	})
+}
+
+func TestDirSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yaegi-template")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	template := MustNew(interp.Options{}, stdlib.Symbols)
+	template.MustParseString(`<$ file("a/b/c.txt") $>Hello`)
+	require.NoError(t, template.ExecFilesTo(DirSink(dir), nil))
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "a", "b", "c.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "Hello", string(b))
+
+	require.Error(t, DirSink(dir).WriteFile("../escape.txt", nil))
+	require.NoError(t, DirSink(dir).WriteFile("12:00.txt", []byte("noon")))
+
+	t.Run("Links", func(t *testing.T) {
+		outside, err := ioutil.TempDir("", "yaegi-template")
+		require.NoError(t, err)
+		defer os.RemoveAll(outside)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0600))
+
+		require.NoError(t, os.Symlink(outside, filepath.Join(dir, "out")))
+		require.NoError(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "alias.txt")))
+		require.NoError(t, os.Symlink(filepath.Join(outside, "new"), filepath.Join(dir, "dangling")))
+		require.NoError(t, os.Symlink(filepath.Join(dir, "a"), filepath.Join(dir, "inside")))
+
+		require.Error(t, DirSink(dir).WriteFile("out/secret.txt", []byte("x")))
+		require.Error(t, DirSink(dir).WriteFile("out/new/file.txt", []byte("x")))
+		require.Error(t, DirSink(dir).WriteFile("alias.txt", []byte("x")))
+		require.Error(t, DirSink(dir).WriteFile("dangling", []byte("x")))
+		require.Error(t, DirSink(dir).WriteFile("dangling/file.txt", []byte("x")))
+
+		b, err := ioutil.ReadFile(filepath.Join(outside, "secret.txt"))
+		require.NoError(t, err)
+		require.Equal(t, "secret", string(b))
+		files, err := ioutil.ReadDir(outside)
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+
+		// links that stay inside of the directory can be used
+		require.NoError(t, DirSink(dir).WriteFile("inside/d.txt", []byte("d")))
+		b, err = ioutil.ReadFile(filepath.Join(dir, "a", "d.txt"))
+		require.NoError(t, err)
+		require.Equal(t, "d", string(b))
+	})
+}
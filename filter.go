@@ -0,0 +1,178 @@
+package yaegi_template
+
+import (
+	"go/scanner"
+	"go/token"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/traefik/yaegi/interp"
+)
+
+// filterPrefix is the prefix of the filter functions inside of the interpreter.
+const filterPrefix = "__filter_"
+
+// filters holds the filters that can be used in expression pipelines, see Template.RegisterFilter.
+type filters map[string]reflect.Value
+
+func defaultFilters() filters {
+	return filters{
+		"upper": reflect.ValueOf(strings.ToUpper),
+		"lower": reflect.ValueOf(strings.ToLower),
+		"title": reflect.ValueOf(strings.Title),
+		"trim":  reflect.ValueOf(strings.TrimSpace),
+		"replace": reflect.ValueOf(func(s, old, new string) string {
+			return strings.ReplaceAll(s, old, new)
+		}),
+		"join": reflect.ValueOf(func(elems []string, sep string) string {
+			return strings.Join(elems, sep)
+		}),
+		"truncate": reflect.ValueOf(func(s string, n int) string {
+			if utf8.RuneCountInString(s) <= n {
+				return s
+			}
+			return string([]rune(s)[:n]) + "…"
+		}),
+	}
+}
+
+// exports returns the filters as symbols of the internal package.
+func (f filters) exports() map[string]reflect.Value {
+	symbols := make(map[string]reflect.Value, len(f))
+	for name, fn := range f {
+		symbols[filterPrefix+name] = fn
+	}
+	return symbols
+}
+
+// RegisterFilter registers a go function as a filter, that can be used in expression pipelines:
+//    template.RegisterFilter("excerpt", func(s string, words int) string { ... })
+//    template.MustParseString(`<$= context.Body | excerpt(20) | upper $>`)
+// The value of the pipeline is passed as the first argument, the function must return exactly one value.
+// The built-in filters are upper, lower, title, trim, replace(old, new), join(sep) and truncate(n).
+func (t *Template) RegisterFilter(name string, fn interface{}) error {
+	if !token.IsIdentifier(name) {
+		return errors.Errorf("invalid filter name %q", name)
+	}
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.Type().NumIn() == 0 || v.Type().NumOut() != 1 {
+		return errors.Errorf("filter %s must be a function with at least one parameter and exactly one result", name)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.filters[name] = v
+	// if we have an interpreter, use right now
+	if t.interp != nil {
+		err := t.interp.Use(interp.Exports{
+			"internal/internal": map[string]reflect.Value{filterPrefix + name: v},
+		})
+		if err != nil {
+			return errors.Wrap(err, "unable to use filter")
+		}
+		if _, err := t.safeEval(`import . "internal"`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MustRegisterFilter is like RegisterFilter, except it panics on failure.
+func (t *Template) MustRegisterFilter(name string, fn interface{}) *Template {
+	if err := t.RegisterFilter(name, fn); err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// rewritePipeline rewrites a pipeline into nested calls of the filter functions:
+//    post.Title | upper | truncate(60)
+// becomes
+//    __filter_truncate(__filter_upper(post.Title), 60)
+// Pipes inside of parentheses, brackets and braces are not treated as pipes, so (a | b) is a bitwise or.
+func (f filters) rewritePipeline(expr string) (string, error) {
+	var (
+		s      scanner.Scanner
+		errs   scanner.ErrorList
+		depth  int
+		splits []int
+	)
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(expr))
+	s.Init(file, []byte(expr), func(pos token.Position, msg string) {
+		errs.Add(pos, msg)
+	}, 0)
+	for {
+		pos, tok, _ := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		switch tok { //nolint:exhaustive // only brackets and pipes are relevant
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.OR:
+			if depth == 0 {
+				splits = append(splits, file.Offset(pos))
+			}
+		}
+	}
+	if errs.Len() > 0 {
+		return "", errs.Err()
+	}
+	if len(splits) == 0 {
+		return expr, nil
+	}
+
+	result := strings.TrimSpace(expr[:splits[0]])
+	if result == "" {
+		return "", errors.New("pipeline has no value")
+	}
+	for i, start := range splits {
+		end := len(expr)
+		if i+1 < len(splits) {
+			end = splits[i+1]
+		}
+		call, err := f.filterCall(expr[start+1:end], start+1, result)
+		if err != nil {
+			return "", err
+		}
+		result = call
+	}
+	return result, nil
+}
+
+// filterCall returns the call of the filter in segment with value as the first argument.
+// offset is the offset of segment in the pipeline, it is used for error messages.
+func (f filters) filterCall(segment string, offset int, value string) (string, error) {
+	trimmed := strings.TrimLeftFunc(segment, isGoSpace)
+	column := offset + len(segment) - len(trimmed) + 1
+	trimmed = strings.TrimRightFunc(trimmed, isGoSpace)
+
+	name := trimmed
+	args := ""
+	if i := strings.IndexByte(trimmed, '('); i >= 0 {
+		if !strings.HasSuffix(trimmed, ")") {
+			return "", errors.Errorf("invalid filter %q at column %d", trimmed, column)
+		}
+		name = strings.TrimRightFunc(trimmed[:i], isGoSpace)
+		args = strings.TrimSpace(trimmed[i+1 : len(trimmed)-1])
+	}
+	if !token.IsIdentifier(name) {
+		return "", errors.Errorf("invalid filter %q at column %d", trimmed, column)
+	}
+	if _, ok := f[name]; !ok {
+		return "", errors.Errorf("unknown filter %q at column %d", name, column)
+	}
+	if args == "" {
+		return filterPrefix + name + "(" + value + ")", nil
+	}
+	return filterPrefix + name + "(" + value + ", " + args + ")", nil
+}
+
+func isGoSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
@@ -0,0 +1,124 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Template    string
+		Expect      string
+		ExpectError string
+	}{
+		{
+			"Single",
+			`<$= context.Title | upper $>`,
+			"HELLO WORLD",
+			"",
+		},
+		{
+			"Chain",
+			`<$= context.Title | upper | truncate(5) $>`,
+			"HELLO…",
+			"",
+		},
+		{
+			"Arguments",
+			`<$= context.Title|replace("o", strings.ToUpper("0"))|title $>`,
+			"Hell0 W0rld",
+			"",
+		},
+		{
+			"Bitwise Or",
+			`<$= (context.Flags | 4) $>`,
+			"5",
+			"",
+		},
+		{
+			"Pipe inside of arguments",
+			`<$= context.Title | truncate(context.Flags | 4) $>`,
+			"hello…",
+			"",
+		},
+		{
+			"Pipe inside of string",
+			`<$= "a|b" | upper $>`,
+			"A|B",
+			"",
+		},
+		{
+			"Custom",
+			`<$= context.Title | shout("!") $>`,
+			"hello world!!!",
+			"",
+		},
+		{
+			"Unknown",
+			`<$= context.Title | upper | uper $>`,
+			"",
+			`expression "context.Title | upper | uper": unknown filter "uper" at column 25`,
+		},
+		{
+			"Invalid",
+			`<$= context.Title | upper( $>`,
+			"",
+			`expression "context.Title | upper(": invalid filter "upper(" at column 17`,
+		},
+		{
+			"No Value",
+			`<$= | upper $>`,
+			"",
+			`expression "| upper": pipeline has no value`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			template := MustNew(interp.Options{}, stdlib.Symbols).
+				MustImport(Import{Path: "strings"}).
+				MustRegisterFilter("shout", func(s, suffix string) string {
+					return s + strings.Repeat(suffix, 3)
+				})
+			err := template.ParseString(test.Template)
+			if test.ExpectError != "" {
+				require.EqualError(t, err, test.ExpectError)
+				return
+			}
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			template.MustExec(&buf, struct {
+				Title string
+				Flags int
+			}{"hello world", 1})
+			require.Equal(t, test.Expect, buf.String())
+		})
+	}
+
+	t.Run("RegisterFilter after LazyParse", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustLazyParse(strings.NewReader(`<$= "a" | double $>`))
+		template.MustRegisterFilter("double", func(s string) string {
+			return s + s
+		})
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		require.Equal(t, "aa", buf.String())
+	})
+
+	t.Run("invalid filters", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols)
+		require.EqualError(t, template.RegisterFilter("no-name", strings.ToUpper), `invalid filter name "no-name"`)
+		require.EqualError(t, template.RegisterFilter("noop", func() string { return "" }),
+			"filter noop must be a function with at least one parameter and exactly one result")
+		require.EqualError(t, template.RegisterFilter("value", "upper"),
+			"filter value must be a function with at least one parameter and exactly one result")
+	})
+}
@@ -0,0 +1,140 @@
+package yaegi_template
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	bytesType    = reflect.TypeOf([]byte(nil))
+)
+
+// formatters formats the values that are written by expression blocks and implicit returns.
+type formatters struct {
+	mu sync.RWMutex
+	// types holds the formatters for concrete types.
+	types map[reflect.Type]func(reflect.Value) string
+	// interfaces holds the formatters for interface types, the last registered formatter has precedence.
+	interfaces []interfaceFormatter
+}
+
+type interfaceFormatter struct {
+	typ    reflect.Type
+	format func(reflect.Value) string
+}
+
+func newFormatters() *formatters {
+	f := &formatters{
+		types: make(map[reflect.Type]func(reflect.Value) string),
+	}
+	f.register(stringerType, func(v reflect.Value) string {
+		return v.Interface().(fmt.Stringer).String()
+	})
+	f.register(errorType, func(v reflect.Value) string {
+		return v.Interface().(error).Error()
+	})
+	f.register(bytesType, func(v reflect.Value) string {
+		return string(v.Bytes())
+	})
+	return f
+}
+
+func (f *formatters) register(typ reflect.Type, format func(reflect.Value) string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if typ.Kind() == reflect.Interface {
+		f.interfaces = append(f.interfaces, interfaceFormatter{typ: typ, format: format})
+		return
+	}
+	f.types[typ] = format
+}
+
+// lookup returns the formatter for values of type typ.
+func (f *formatters) lookup(typ reflect.Type) (func(reflect.Value) string, bool) {
+	if f == nil {
+		return nil, false
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if format, ok := f.types[typ]; ok {
+		return format, true
+	}
+	for i := len(f.interfaces) - 1; i >= 0; i-- {
+		if typ.Implements(f.interfaces[i].typ) {
+			return f.interfaces[i].format, true
+		}
+	}
+	return nil, false
+}
+
+// format returns the string representation of v.
+// Pointers are formatted as their element (unless they have a formatter, e.g. fmt.Stringer), nil values, functions
+// and channels are formatted as an empty string, renderValue of the generated code does the same
+// (see generator.source).
+func (f *formatters) format(v reflect.Value) string {
+	for v.IsValid() && v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || !v.CanInterface() {
+		return ""
+	}
+
+	if format, ok := f.lookup(v.Type()); ok {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return ""
+		}
+		return format(v)
+	}
+
+	//nolint:exhaustive // all other kinds are formatted as an empty string
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128,
+		reflect.Struct, reflect.Array:
+		return fmt.Sprint(v.Interface())
+	case reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return ""
+		}
+		return fmt.Sprint(v.Interface())
+	case reflect.Ptr:
+		if v.IsNil() {
+			return ""
+		}
+		return f.format(v.Elem())
+	default:
+		return ""
+	}
+}
+
+// hidesResult returns true if v is the result of the code (implicit return) that is not written.
+// These are pointers without a formatter, the interpreter returns pointers for declarations (e.g. var x int).
+func (f *formatters) hidesResult(v reflect.Value) bool {
+	for v.IsValid() && v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.Kind() != reflect.Ptr {
+		return false
+	}
+	_, ok := f.lookup(v.Type())
+	return !ok
+}
+
+// RegisterFormatter registers a formatter for the values of the specified type, that are written by
+// expression blocks (<$= $>) and implicit returns.
+// If typ is an interface type, the formatter is used for all values that implement the interface:
+//    template.RegisterFormatter(reflect.TypeOf(time.Time{}), func(v reflect.Value) string {
+//        return v.Interface().(time.Time).Format("2006-01-02")
+//    })
+// By default fmt.Stringer, error and []byte values are formatted with their String(), Error() and string conversion.
+// Note that the formatters are not used by the go code generator.
+func (t *Template) RegisterFormatter(typ reflect.Type, format func(reflect.Value) string) {
+	t.formatters.register(typ, format)
+}
@@ -0,0 +1,97 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+type testStringer struct{}
+
+func (testStringer) String() string {
+	return "stringer"
+}
+
+func TestFormatter(t *testing.T) {
+	date := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		Name   string
+		Value  interface{}
+		Expect string
+	}{
+		{"Stringer", testStringer{}, "stringer"},
+		{"Error", errors.New("failed"), "failed"},
+		{"Bytes", []byte("bytes"), "bytes"},
+		{"Time", date, date.String()},
+		{"Slice", []int{1, 2, 3}, "[1 2 3]"},
+		{"Map", map[string]int{"a": 1}, "map[a:1]"},
+		{"Struct", struct{ A, B int }{1, 2}, "{1 2}"},
+		{"Named String", SafeHTML("safe"), "safe"},
+		{"Nil Slice", []int(nil), ""},
+		{"Nil Pointer", (*testStringer)(nil), ""},
+		{"Pointer", &struct{ A int }{1}, "{1}"},
+		{"Stringer Pointer", &testStringer{}, "stringer"},
+		{"Func", func() {}, ""},
+		{"Chan", make(chan int), ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			template := MustNew(interp.Options{}, stdlib.Symbols).
+				MustParseString(`<$= context["value"] $>`)
+
+			var buf bytes.Buffer
+			template.MustExec(&buf, map[string]interface{}{"value": test.Value})
+			require.Equal(t, test.Expect, buf.String())
+		})
+	}
+
+	t.Run("RegisterFormatter", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<$= context.Date $> <$= context.Err $>`)
+		template.RegisterFormatter(reflect.TypeOf(time.Time{}), func(v reflect.Value) string {
+			return v.Interface().(time.Time).Format("2006-01-02")
+		})
+		template.RegisterFormatter(reflect.TypeOf((*error)(nil)).Elem(), func(v reflect.Value) string {
+			return "error: " + v.Interface().(error).Error()
+		})
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, struct {
+			Date time.Time
+			Err  error
+		}{date, errors.New("failed")})
+		require.Equal(t, "2020-01-02 error: failed", buf.String())
+	})
+
+	t.Run("Declarations", func(t *testing.T) {
+		for _, src := range []string{
+			`<$ var x = 1 $>`,
+			`<$ func f() int { return 1 } $>`,
+			`<$ type T struct{ A int } $>`,
+			`<$ import "strings" $><$ strings.NewReader("x") $>`,
+		} {
+			template := MustNew(interp.Options{}, stdlib.Symbols).MustParseString(src)
+			var buf bytes.Buffer
+			template.MustExec(&buf, nil)
+			require.Equal(t, "", buf.String(), src)
+		}
+	})
+
+	t.Run("Implicit Return", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols)
+		template.StartTokens = nil
+		template.EndTokens = nil
+		template.MustParseString(`context`)
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, []string{"a", "b"})
+		require.Equal(t, "[a b]", buf.String())
+	})
+}
@@ -0,0 +1,54 @@
+package yaegi_template
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+var frontMatterDelimiter = []byte("---")
+
+// parseFrontMatter parses an optional front matter header, fenced by "---" lines, at the beginning of content.
+// The front matter can be written in YAML or JSON.
+// It returns the parsed front matter (nil if content has no front matter) and the remaining content.
+func parseFrontMatter(content []byte) (map[string]interface{}, []byte, error) {
+	header, rest, ok := cutLine(content)
+	if !ok || !bytes.Equal(bytes.TrimRightFunc(header, isSpace), frontMatterDelimiter) {
+		return nil, content, nil
+	}
+
+	var source []byte
+	for {
+		var line []byte
+		line, rest, ok = cutLine(rest)
+		if bytes.Equal(bytes.TrimRightFunc(line, isSpace), frontMatterDelimiter) {
+			break
+		}
+		if !ok {
+			return nil, nil, errors.New("front matter was not closed, missing ---")
+		}
+		source = append(source, line...)
+		source = append(source, '\n')
+	}
+
+	meta := make(map[string]interface{})
+	if err := yaml.Unmarshal(source, &meta); err != nil {
+		return nil, nil, errors.Wrap(err, "unable to parse front matter")
+	}
+	return meta, rest, nil
+}
+
+// cutLine returns the first line of b (without the line ending) and the remaining bytes,
+// ok is false if b does not contain a line ending.
+func cutLine(b []byte) (line, rest []byte, ok bool) {
+	i := bytes.IndexByte(b, '\n')
+	if i < 0 {
+		return b, nil, false
+	}
+	return bytes.TrimSuffix(b[:i], []byte{'\r'}), b[i+1:], true
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\r'
+}
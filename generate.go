@@ -0,0 +1,608 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"github.com/Eun/yaegi-template/helpers"
+)
+
+// GenerateOptions configures the go code generator, see Template.Generate.
+type GenerateOptions struct {
+	// Package is the package name of the generated file, defaults to main.
+	Package string
+	// FuncName is the name of the generated render function, defaults to Render.
+	FuncName string
+	// ContextType is the type of the context parameter, defaults to interface{}.
+	ContextType string
+	// Imports are additional imports for the generated file, e.g. the package of the ContextType.
+	Imports []Import
+	// ImportMap maps import paths used in the template to the import paths used in the generated file.
+	// This is useful for packages that were provided to the interpreter with Use().
+	// The helpers package is mapped to github.com/Eun/yaegi-template/helpers by default.
+	ImportMap map[string]string
+	// Context is a value of the type of the context, it is used to type check the template (see Validate).
+	// If the last statement of the template is a call, its result is only written if its type is known, so calls
+	// that depend on the context need the Context.
+	Context interface{}
+}
+
+// Generate transpiles the parsed template into a go source file and writes it to w.
+// The generated file contains a function
+//    func Render(w io.Writer, context T) error
+// with the code blocks inlined and the text parts written as constants.
+// This makes it possible to use compiled code in production while using the interpreter during development.
+//
+// Text written by print(), println() and the fmt.Print functions is written to w,
+// macros are converted into closures and the prelude is placed at package level.
+func (t *Template) Generate(w io.Writer, options GenerateOptions) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.codeBuffer == nil {
+		return errors.New("template was never parsed")
+	}
+	if t.Escaper != nil {
+		return errors.New("templates with an escaper can not be generated")
+	}
+	if t.AutoIndent {
+		return errors.New("templates with auto indentation can not be generated")
+	}
+	if t.GoOutput {
+		return errors.New("templates with go output can not be generated")
+	}
+
+	g := generator{
+		options: options,
+	}
+	if g.options.Package == "" {
+		g.options.Package = "main"
+	}
+	if g.options.FuncName == "" {
+		g.options.FuncName = "Render"
+	}
+	if g.options.ContextType == "" {
+		g.options.ContextType = "interface{}"
+	}
+	g.prefix = string(unicode.ToLower(rune(g.options.FuncName[0]))) + g.options.FuncName[1:]
+
+	prog := program{constantPrefix: g.prefix + "Text", valueFunc: g.prefix + "Value"}
+	if err := t.compile(&prog); err != nil {
+		return err
+	}
+
+	g.addImports(Import{Path: "fmt"}, Import{Path: "io"}, Import{Path: "reflect"})
+	g.addImports(t.imports...)
+	g.addImports(g.options.Imports...)
+
+	for _, code := range t.prelude {
+		imports, src, err := t.extractImports(code)
+		if err != nil {
+			return wrapSourceError(err, "generation of prelude", code)
+		}
+		g.addImports(imports...)
+		g.decls = append(g.decls, strings.TrimSpace(src))
+	}
+
+	imports, macros, err := t.extractImports(prog.macros.String())
+	if err != nil {
+		return wrapSourceError(err, "generation of", prog.macros.String())
+	}
+	g.addImports(imports...)
+
+	isPackage, err := t.hasPackage(prog.code.String())
+	if err != nil {
+		return wrapSourceError(err, "generation of", prog.code.String())
+	}
+	imports, code, err := t.extractImports(prog.code.String())
+	if err != nil {
+		return wrapSourceError(err, "generation of", prog.code.String())
+	}
+	g.addImports(imports...)
+
+	if !isPackage {
+		// the type of the last call decides whether its result is written
+		v, err := t.newValidator(&prog, options.Context)
+		if err != nil {
+			return err
+		}
+		_ = v.check()
+		g.lastCallResults, g.lastCallKnown = v.lastCallResults()
+	}
+
+	if err := g.generateBody(strings.Join(prog.macroDecls, "\n"), macros, code, isPackage); err != nil {
+		return err
+	}
+
+	src, err := g.source(&prog)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// generator holds the state of the go code generation.
+type generator struct {
+	options GenerateOptions
+	// prefix is used for all package level identifiers.
+	prefix  string
+	imports importSymbols
+	// decls are the package level declarations.
+	decls []string
+	// body is the body of the render function.
+	body []string
+	// idents holds all identifiers that are used in the body.
+	idents map[string]bool
+	// implicitReturn is true if the body contains an implicit return.
+	implicitReturn bool
+	// lastCallResults is the number of results of the call that is the last statement of the code,
+	// lastCallKnown is false if the number is unknown.
+	lastCallResults int
+	lastCallKnown   bool
+	// writers are the w arguments of rewritten fmt.Fprint calls.
+	writers []*ast.Ident
+}
+
+func (g *generator) addImports(imports ...Import) {
+	for _, imp := range imports {
+		p, ok := g.options.ImportMap[imp.Path]
+		if !ok && imp.Path == helpers.ImportPath {
+			p, ok = "github.com/Eun/yaegi-template/helpers", true
+		}
+		if ok {
+			if imp.Name == "" && path.Base(p) != path.Base(imp.Path) {
+				imp.Name = path.Base(imp.Path)
+			}
+			imp.Path = p
+		}
+		if !g.imports.Contains(imp) {
+			g.imports = append(g.imports, imp)
+		}
+	}
+}
+
+// generateBody generates the body of the render function.
+func (g *generator) generateBody(macroDecls, macros, code string, isPackage bool) error {
+	fset := token.NewFileSet()
+	var stmts []ast.Stmt
+
+	src := "package main\nfunc _() {\n" + macroDecls + "\n" + macros + "\n"
+	if !isPackage {
+		src += code
+	}
+	src += "\n}"
+	f, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return wrapSourceError(err, "generation of", src)
+	}
+	stmts = append(stmts, f.Decls[0].(*ast.FuncDecl).Body.List...)
+
+	if isPackage {
+		pkgStmts, err := g.packageStmts(fset, code)
+		if err != nil {
+			return err
+		}
+		stmts = append(stmts, pkgStmts...)
+	}
+
+	block := &ast.BlockStmt{List: stmts}
+	g.rewritePrints(block)
+	if !isPackage {
+		// the interpreter does not write the result of a package
+		g.rewriteImplicitReturn(block)
+	}
+	if g.implicitReturn {
+		// writes of fmt.Fprint must be noticed by the implicit return
+		for _, ident := range g.writers {
+			ident.Name = g.prefix + "Writer"
+		}
+	}
+
+	g.idents = make(map[string]bool)
+	ast.Inspect(block, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Ident); ok {
+			g.idents[ident.Name] = true
+		}
+		return true
+	})
+
+	for _, stmt := range block.List {
+		var buf bytes.Buffer
+		if err := format.Node(&buf, fset, stmt); err != nil {
+			return errors.Wrap(err, "unable to format statement")
+		}
+		g.body = append(g.body, buf.String())
+	}
+	return nil
+}
+
+// packageStmts converts the declarations of a template that has a package clause into statements.
+// The body of the main function is inlined, other functions are converted into closures and all other
+// declarations are placed at package level.
+func (g *generator) packageStmts(fset *token.FileSet, code string) ([]ast.Stmt, error) {
+	src := "package main\n" + code
+	f, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return nil, wrapSourceError(err, "generation of", src)
+	}
+
+	var closures, mainStmts []ast.Stmt
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil {
+			var buf bytes.Buffer
+			if err := format.Node(&buf, fset, decl); err != nil {
+				return nil, errors.Wrap(err, "unable to format declaration")
+			}
+			g.decls = append(g.decls, buf.String())
+			continue
+		}
+		if fn.Name.Name == "main" {
+			mainStmts = fn.Body.List
+			continue
+		}
+		// func Name(...) {...} => var Name func(...); Name = func(...) {...}
+		closures = append([]ast.Stmt{&ast.DeclStmt{Decl: &ast.GenDecl{
+			Tok: token.VAR,
+			Specs: []ast.Spec{&ast.ValueSpec{
+				Names: []*ast.Ident{ast.NewIdent(fn.Name.Name)},
+				Type:  fn.Type,
+			}},
+		}}}, closures...)
+		closures = append(closures, &ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent(fn.Name.Name)},
+			Tok: token.ASSIGN,
+			Rhs: []ast.Expr{&ast.FuncLit{Type: fn.Type, Body: fn.Body}},
+		})
+	}
+	return append(closures, mainStmts...), nil
+}
+
+var fmtPrintFuncs = map[string]string{
+	"Print":   "Sprint",
+	"Printf":  "Sprintf",
+	"Println": "Sprintln",
+}
+
+// rewritePrints rewrites all fmt.Print, fmt.Printf and fmt.Println calls, so they write into the output.
+// Calls that are used as statements are rewritten to print(fmt.Sprint(...)), all other calls to fmt.Fprint(w, ...).
+func (g *generator) rewritePrints(block *ast.BlockStmt) {
+	ast.Inspect(block, func(node ast.Node) bool {
+		stmt, ok := node.(*ast.ExprStmt)
+		if !ok {
+			return true
+		}
+		call, ok := stmt.X.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if name := g.fmtPrintFunc(call); name != "" {
+			call.Fun.(*ast.SelectorExpr).Sel.Name = fmtPrintFuncs[name]
+			stmt.X = &ast.CallExpr{Fun: ast.NewIdent("print"), Args: []ast.Expr{call}}
+		}
+		return true
+	})
+
+	ast.Inspect(block, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if name := g.fmtPrintFunc(call); name != "" {
+			call.Fun.(*ast.SelectorExpr).Sel.Name = "F" + strings.ToLower(name[:1]) + name[1:]
+			writer := ast.NewIdent("w")
+			g.writers = append(g.writers, writer)
+			call.Args = append([]ast.Expr{writer}, call.Args...)
+		}
+		return true
+	})
+}
+
+// fmtPrintFunc returns the name of the fmt print function that is called by call.
+func (g *generator) fmtPrintFunc(call *ast.CallExpr) string {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok || pkg.Name != g.importName("fmt") {
+		return ""
+	}
+	if _, ok := fmtPrintFuncs[sel.Sel.Name]; !ok {
+		return ""
+	}
+	return sel.Sel.Name
+}
+
+// importName returns the name that is used for the import path.
+func (g *generator) importName(importPath string) string {
+	for _, imp := range g.imports {
+		if imp.Path == importPath && imp.Name != "" {
+			return imp.Name
+		}
+	}
+	return path.Base(importPath)
+}
+
+// rewriteImplicitReturn rewrites the last statement to print its value, if nothing else was written.
+// Calls are only rewritten if they have results, the first result is written like the interpreter does.
+func (g *generator) rewriteImplicitReturn(block *ast.BlockStmt) {
+	if len(block.List) == 0 {
+		return
+	}
+	stmt, ok := block.List[len(block.List)-1].(*ast.ExprStmt)
+	if !ok {
+		return
+	}
+	results := 1
+	if _, ok := stmt.X.(*ast.CallExpr); ok {
+		if !g.lastCallKnown || g.lastCallResults == 0 {
+			return
+		}
+		results = g.lastCallResults
+	}
+	g.implicitReturn = true
+	// if v, _ := expr; !written { print(renderResult(v)) }
+	lhs := []ast.Expr{ast.NewIdent("v")}
+	for i := 1; i < results; i++ {
+		lhs = append(lhs, ast.NewIdent("_"))
+	}
+	block.List[len(block.List)-1] = &ast.IfStmt{
+		Init: &ast.AssignStmt{Lhs: lhs, Tok: token.DEFINE, Rhs: []ast.Expr{stmt.X}},
+		Cond: &ast.UnaryExpr{Op: token.NOT, X: ast.NewIdent("written")},
+		Body: &ast.BlockStmt{List: []ast.Stmt{&ast.ExprStmt{X: &ast.CallExpr{
+			Fun: ast.NewIdent("print"),
+			Args: []ast.Expr{&ast.CallExpr{
+				Fun:  ast.NewIdent(g.prefix + "Result"),
+				Args: []ast.Expr{ast.NewIdent("v")},
+			}},
+		}}}},
+	}
+}
+
+// source assembles and formats the go source file.
+func (g *generator) source(prog *program) ([]byte, error) {
+	var sb strings.Builder
+	sb.WriteString("// Code generated by yaegi-template. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&sb, "package %s\n\n", g.options.Package)
+
+	var rest strings.Builder
+	if len(prog.texts) > 0 {
+		rest.WriteString("const (\n")
+		for i, text := range prog.texts {
+			fmt.Fprintf(&rest, "\t%s%d = %s\n", prog.constantPrefix, i, strconv.Quote(string(text)))
+		}
+		rest.WriteString(")\n\n")
+	}
+	if prog.meta != nil && g.idents["meta"] {
+		g.addImports(Import{Path: "math"}, Import{Path: "time"})
+		fmt.Fprintf(&rest, "var %sMeta = %s\n\n", g.prefix, metaLiteral(prog.meta))
+	}
+	for _, decl := range g.decls {
+		rest.WriteString(decl)
+		rest.WriteString("\n\n")
+	}
+
+	fmt.Fprintf(&rest, "// %s renders the template into w.\n", g.options.FuncName)
+	fmt.Fprintf(&rest, "func %s(w io.Writer, context %s) (err error) {\n", g.options.FuncName, g.options.ContextType)
+	fmt.Fprintf(&rest, `defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(%sError)
+			if !ok {
+				panic(r)
+			}
+			err = e.err
+		}
+	}()
+`, g.prefix)
+	if g.implicitReturn {
+		rest.WriteString("written := false\n")
+	}
+	if g.implicitReturn && len(g.writers) > 0 {
+		fmt.Fprintf(&rest, `%[1]sWriter := %[1]sWriterFunc(func(p []byte) (int, error) {
+			if len(p) > 0 {
+				written = true
+			}
+			return w.Write(p)
+		})
+`, g.prefix)
+	}
+	if g.idents["print"] || g.idents["println"] {
+		rest.WriteString("print := func(a ...interface{}) {\n")
+		rest.WriteString("s := fmt.Sprintln(a...)\n")
+		if g.implicitReturn {
+			rest.WriteString("if len(s) > 1 {\nwritten = true\n}\n")
+		}
+		fmt.Fprintf(&rest, `if _, err := io.WriteString(w, s[:len(s)-1]); err != nil {
+				panic(%sError{err: err})
+			}
+		}
+`, g.prefix)
+	}
+	if g.idents["println"] {
+		rest.WriteString("println := func(a ...interface{}) {\nprint(fmt.Sprintln(a...))\n}\n")
+	}
+	if g.idents["raw"] {
+		// there is no escaping in generated code, so raw values can be written as they are
+		rest.WriteString("raw := func(v interface{}) interface{} {\nreturn v\n}\n")
+	}
+	if g.idents["indent"] {
+		g.addImports(Import{Path: "github.com/Eun/yaegi-template/helpers"})
+		fmt.Fprintf(&rest, "indent := %s.Indent\n", g.importName("github.com/Eun/yaegi-template/helpers"))
+	}
+	if prog.meta != nil && g.idents["meta"] {
+		fmt.Fprintf(&rest, "meta := %sMeta\n_ = meta\n", g.prefix)
+	}
+	for _, stmt := range g.body {
+		rest.WriteString(stmt)
+		rest.WriteRune('\n')
+	}
+	rest.WriteString("return nil\n}\n\n")
+
+	fmt.Fprintf(&rest, "type %sError struct {\nerr error\n}\n", g.prefix)
+	if g.implicitReturn && len(g.writers) > 0 {
+		fmt.Fprintf(&rest, `
+type %[1]sWriterFunc func(p []byte) (int, error)
+
+func (f %[1]sWriterFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+`, g.prefix)
+	}
+	if g.implicitReturn || prog.hasValues {
+		fmt.Fprintf(&rest, `
+func %[1]sValue(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return ""
+	case reflect.Slice, reflect.Map, reflect.Ptr:
+		if rv.IsNil() {
+			return ""
+		}
+	}
+	switch x := v.(type) {
+	case fmt.Stringer:
+		return x.String()
+	case error:
+		return x.Error()
+	case []byte:
+		return string(x)
+	}
+	if rv.Kind() == reflect.Ptr {
+		return %[1]sValue(rv.Elem().Interface())
+	}
+	return fmt.Sprint(v)
+}
+`, g.prefix)
+	}
+	if g.implicitReturn {
+		fmt.Fprintf(&rest, `
+func %[1]sResult(v interface{}) string {
+	if reflect.ValueOf(v).Kind() == reflect.Ptr {
+		switch v.(type) {
+		case fmt.Stringer, error:
+		default:
+			return ""
+		}
+	}
+	return %[1]sValue(v)
+}
+`, g.prefix)
+	}
+
+	g.writeImports(&sb, rest.String())
+	sb.WriteString(rest.String())
+
+	src, err := format.Source([]byte(sb.String()))
+	if err != nil {
+		return nil, wrapSourceError(err, "formatting of generated code", sb.String())
+	}
+	return src, nil
+}
+
+// metaLiteral returns the go expression of a value of the front matter.
+// %#v is not used for all values, because it is no valid go code for times with a location and it loses the type
+// of floats that have no fraction.
+func metaLiteral(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "nil"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var sb strings.Builder
+		sb.WriteString("map[string]interface{}{")
+		for _, k := range keys {
+			fmt.Fprintf(&sb, "%s: %s, ", strconv.Quote(k), metaLiteral(x[k]))
+		}
+		sb.WriteString("}")
+		return sb.String()
+	case map[interface{}]interface{}:
+		var entries []string
+		for k, value := range x {
+			entries = append(entries, metaLiteral(k)+": "+metaLiteral(value)+", ")
+		}
+		sort.Strings(entries)
+		return "map[interface{}]interface{}{" + strings.Join(entries, "") + "}"
+	case []interface{}:
+		var sb strings.Builder
+		sb.WriteString("[]interface{}{")
+		for _, value := range x {
+			sb.WriteString(metaLiteral(value))
+			sb.WriteString(", ")
+		}
+		sb.WriteString("}")
+		return sb.String()
+	case float64:
+		if math.IsInf(x, 0) || math.IsNaN(x) {
+			return fmt.Sprintf("math.Float64frombits(%#x)", math.Float64bits(x))
+		}
+		return "float64(" + strconv.FormatFloat(x, 'g', -1, 64) + ")"
+	case time.Time:
+		zone := "time.UTC"
+		if x.Location() != time.UTC {
+			name, offset := x.Zone()
+			zone = fmt.Sprintf("time.FixedZone(%s, %d)", strconv.Quote(name), offset)
+		}
+		return fmt.Sprintf("time.Date(%d, %d, %d, %d, %d, %d, %d, %s)",
+			x.Year(), x.Month(), x.Day(), x.Hour(), x.Minute(), x.Second(), x.Nanosecond(), zone)
+	}
+	return fmt.Sprintf("%#v", v)
+}
+
+// writeImports writes the import block, imports that are not used in src are omitted.
+func (g *generator) writeImports(sb *strings.Builder, src string) {
+	used := make(map[string]bool)
+	f, err := parser.ParseFile(token.NewFileSet(), "", "package main\n"+src, 0)
+	if err == nil {
+		ast.Inspect(f, func(node ast.Node) bool {
+			if sel, ok := node.(*ast.SelectorExpr); ok {
+				if ident, ok := sel.X.(*ast.Ident); ok && ident.Obj == nil {
+					used[ident.Name] = true
+				}
+			}
+			return true
+		})
+	}
+
+	var lines []string
+	for _, imp := range g.imports {
+		name := imp.Name
+		if name == "" {
+			name = path.Base(imp.Path)
+		}
+		// keep the import if we cannot tell whether it is used (e.g. the source has syntax errors)
+		if err == nil && token.IsIdentifier(name) && !used[name] {
+			continue
+		}
+		lines = append(lines, imp.importLine())
+	}
+	if len(lines) == 0 {
+		return
+	}
+	sort.Strings(lines)
+	sb.WriteString("import (\n")
+	for _, line := range lines {
+		sb.WriteString(line)
+		sb.WriteRune('\n')
+	}
+	sb.WriteString(")\n\n")
+}
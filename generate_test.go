@@ -0,0 +1,272 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+func TestTemplate_Generate(t *testing.T) {
+	t.Run("simple", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<$ import "strings" $><ul><$ for _, name := range context.Names { $><li><$ fmt.Printf("%s", strings.ToUpper(name)) $></li><$ } $></ul>`)
+
+		var buf bytes.Buffer
+		require.NoError(t, template.Generate(&buf, GenerateOptions{
+			Package:     "views",
+			FuncName:    "RenderList",
+			ContextType: "*List",
+		}))
+		require.Equal(t, `// Code generated by yaegi-template. DO NOT EDIT.
+
+package views
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	renderListText0 = "<ul>"
+	renderListText1 = "<li>"
+	renderListText2 = "</li>"
+	renderListText3 = "</ul>"
+)
+
+// RenderList renders the template into w.
+func RenderList(w io.Writer, context *List) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(renderListError)
+			if !ok {
+				panic(r)
+			}
+			err = e.err
+		}
+	}()
+	print := func(a ...interface{}) {
+		s := fmt.Sprintln(a...)
+		if _, err := io.WriteString(w, s[:len(s)-1]); err != nil {
+			panic(renderListError{err: err})
+		}
+	}
+	print(renderListText0)
+	for _, name := range context.Names {
+		print(renderListText1)
+		print(fmt.Sprintf("%s", strings.ToUpper(name)))
+		print(renderListText2)
+	}
+	print(renderListText3)
+	return nil
+}
+
+type renderListError struct {
+	err error
+}
+`, buf.String())
+	})
+
+	t.Run("macros and implicit return", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols, interp.Exports{
+			"ext/ext": map[string]reflect.Value{
+				"Title": reflect.ValueOf("Hello"),
+			},
+		}).
+			MustImport(Import{Path: "ext"}).
+			MustParseString(`<$ Card(ext.Title) $><$ macro Card(title string) $><h1><$ print(title) $></h1><$ end $><$ context.Name $>`)
+
+		var buf bytes.Buffer
+		require.NoError(t, template.Generate(&buf, GenerateOptions{
+			ContextType: "Context",
+			ImportMap:   map[string]string{"ext": "github.com/acme/extensions"},
+		}))
+		require.Contains(t, buf.String(), "package main\n")
+		require.Contains(t, buf.String(), "\text \"github.com/acme/extensions\"\n")
+		require.Contains(t, buf.String(), "func Render(w io.Writer, context Context) (err error) {")
+		require.Contains(t, buf.String(), `	var Card func(title string)
+	Card = func(title string) {
+		print(renderText0)
+		print(title)
+		print(renderText1)
+	}
+	Card(ext.Title)
+	if v := context.Name; !written {
+		print(renderResult(v))
+	}
+	return nil`)
+		require.Contains(t, buf.String(), "func renderValue(v interface{}) string {")
+		require.Contains(t, buf.String(), "func renderResult(v interface{}) string {")
+	})
+
+	t.Run("package", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<$
+package main
+
+import "fmt"
+
+const greeting = "Hello"
+
+func greet(name string) {
+	fmt.Println(greeting, name)
+}
+
+func main() {
+	greet("Joe")
+	n, _ := fmt.Printf("!")
+	_ = n
+}
+$>`)
+
+		var buf bytes.Buffer
+		require.NoError(t, template.Generate(&buf, GenerateOptions{}))
+		require.Contains(t, buf.String(), "const greeting = \"Hello\"\n")
+		require.Contains(t, buf.String(), `	var greet func(name string)
+	greet = func(name string) {
+		print(fmt.Sprintln(greeting, name))
+	}
+	greet("Joe")
+	n, _ := fmt.Fprintf(w, "!")`)
+	})
+
+	t.Run("expression", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<p><$= context.Count $><$= raw(context.Name) $></p>`)
+
+		var buf bytes.Buffer
+		require.NoError(t, template.Generate(&buf, GenerateOptions{}))
+		require.Contains(t, buf.String(), "print(renderValue(context.Count))")
+		require.Contains(t, buf.String(), "raw := func(v interface{}) interface{} {")
+		require.Contains(t, buf.String(), "func renderValue(v interface{}) string {")
+	})
+
+	t.Run("helpers", func(t *testing.T) {
+		template := MustNew(interp.Options{}, DefaultSymbols()...).
+			MustParseString(`<$ import "yaegi-template/helpers" $><$= helpers.ByteSize(context.Size) $>`)
+
+		var buf bytes.Buffer
+		require.NoError(t, template.Generate(&buf, GenerateOptions{}))
+		require.Contains(t, buf.String(), "\t\"github.com/Eun/yaegi-template/helpers\"\n")
+	})
+
+	t.Run("indent", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString("items:\n<$= indent(2, context.Items) $>")
+
+		var buf bytes.Buffer
+		require.NoError(t, template.Generate(&buf, GenerateOptions{}))
+		require.Contains(t, buf.String(), "\t\"github.com/Eun/yaegi-template/helpers\"\n")
+		require.Contains(t, buf.String(), "indent := helpers.Indent\n")
+
+		template.AutoIndent = true
+		require.EqualError(t, template.Generate(&buf, GenerateOptions{}), "templates with auto indentation can not be generated")
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<p><$= context.Name | upper $></p>`)
+		require.EqualError(t, template.Generate(nil, GenerateOptions{}),
+			`expression "context.Name | upper": filters are not supported by the go code generator`)
+	})
+
+	t.Run("escaper", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols)
+		template.Escaper = NewHTMLEscaper()
+		template.MustParseString(`<p><$= context.Name $></p>`)
+		require.EqualError(t, template.Generate(nil, GenerateOptions{}), "templates with an escaper can not be generated")
+	})
+
+	t.Run("not parsed", func(t *testing.T) {
+		require.EqualError(t, MustNew(interp.Options{}).Generate(nil, GenerateOptions{}), "template was never parsed")
+	})
+}
+
+type generateContext struct {
+	Name  string
+	Items []string
+}
+
+func TestTemplate_GenerateMatchesExec(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping build of generated code in short mode")
+	}
+	goBinary, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not available")
+	}
+
+	templates := []string{
+		`<$ import ("fmt"; "strings") $><ul><$ for _, item := range context.Items { $><li><$ fmt.Printf("%s", strings.ToUpper(item)) $></li><$ } $></ul>`,
+		`<$ import "strings" $><$ strings.Repeat(context.Name, 2) $>`,
+		`<$ import "strconv" $><$ strconv.Atoi("12") $>`,
+		`<$ import "fmt" $><$ n, _ := fmt.Print("written"); _ = n $><$ context.Name $>`,
+		`<$ macro Hello(name string) $>Hello <$= name $><$ end $><$ Hello(context.Name) $>`,
+		`<$ x := len(context.Items) $><$ x * 2 $>`,
+		`<$ import "fmt" $><$ fmt.Sprint(context.Items) $>`,
+		`<$ x, items := context.Name, context.Items $><$= &x $>|<$= &items $>`,
+		`<$ x := context.Name $><$ &x $>`,
+		"---\ndate: 2020-01-02T03:04:05+02:00\nratio: 1.0\n---\n<$= meta[\"date\"] $> <$= meta[\"ratio\"] $>",
+	}
+	context := generateContext{Name: "Joe", Items: []string{"a", "b"}}
+
+	dir, err := ioutil.TempDir("", "generate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var expected, calls strings.Builder
+	for i, src := range templates {
+		template := MustNew(interp.Options{}, stdlib.Symbols)
+		template.FrontMatter = true
+		template.MustParseString(src)
+		var buf bytes.Buffer
+		_, err := template.Exec(&buf, context)
+		require.NoError(t, err)
+		fmt.Fprintf(&expected, "%d:%s\n", i, buf.String())
+
+		buf.Reset()
+		funcName := fmt.Sprintf("Render%d", i)
+		require.NoError(t, template.Generate(&buf, GenerateOptions{
+			FuncName:    funcName,
+			ContextType: "generateContext",
+			Context:     context,
+		}))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("render%d.go", i)), buf.Bytes(), 0600))
+		fmt.Fprintf(&calls, "\tfmt.Print(\"%d:\")\n\tif err := %s(os.Stdout, context); err != nil {\n\t\tpanic(err)\n\t}\n\tfmt.Println()\n", i, funcName)
+	}
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module generated\n\ngo 1.15\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(`package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type generateContext struct {
+	Name  string
+	Items []string
+}
+
+func main() {
+	context := generateContext{Name: "Joe", Items: []string{"a", "b"}}
+`+calls.String()+`}
+`), 0600))
+
+	cmd := exec.Command(goBinary, "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=", "GO111MODULE=on")
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	require.Equal(t, expected.String(), string(output))
+}
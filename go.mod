@@ -7,4 +7,5 @@ require (
 	github.com/stretchr/testify v1.8.2
 	github.com/traefik/yaegi v0.9.21
 	go.uber.org/atomic v1.9.0
+	gopkg.in/yaml.v3 v3.0.1
 )
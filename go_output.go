@@ -0,0 +1,258 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/traefik/yaegi/stdlib"
+
+	"github.com/Eun/yaegi-template/codebuffer"
+)
+
+// preferredImports resolves package names that are used by multiple standard packages.
+var preferredImports = map[string]string{
+	"rand":     "math/rand",
+	"template": "text/template",
+	"scanner":  "go/scanner",
+}
+
+// stdlibPackages maps the names of the standard packages to their import paths.
+var stdlibPackages = func() map[string][]string {
+	m := make(map[string][]string)
+	for key := range stdlib.Symbols {
+		// the keys have the form import/path/name
+		importPath, name := path.Split(key)
+		importPath = strings.TrimSuffix(importPath, "/")
+		if strings.Contains(importPath, "internal") {
+			continue
+		}
+		m[name] = append(m[name], importPath)
+	}
+	for name := range m {
+		paths := m[name]
+		sort.Slice(paths, func(i, j int) bool {
+			if len(paths[i]) != len(paths[j]) {
+				return len(paths[i]) < len(paths[j])
+			}
+			return paths[i] < paths[j]
+		})
+	}
+	return m
+}()
+
+// formatGoOutput formats the output of a template that renders go source (see Template.GoOutput).
+// Imports of standard packages are added or removed as needed. Syntax errors are reported with the
+// line of the output and the position in the template that produced it.
+func formatGoOutput(prog *program, segments []outputSegment, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, wrapSourceError(goOutputError(prog, segments, src, err), "formatting of go output", string(src))
+	}
+
+	src = fixImports(fset, file, src)
+
+	out, err := format.Source(src)
+	if err != nil {
+		return nil, wrapSourceError(err, "formatting of go output", string(src))
+	}
+	return out, nil
+}
+
+// goOutputError adds the position in the template to a syntax error of the output.
+func goOutputError(prog *program, segments []outputSegment, src []byte, err error) error {
+	list, ok := err.(scanner.ErrorList)
+	if !ok || len(list) == 0 {
+		return err
+	}
+	pos := list[0].Pos
+	line, column, ok := templatePosition(prog, segments, src, pos.Offset)
+	if !ok {
+		return errors.Errorf("output line %d:%d: %s", pos.Line, pos.Column, list[0].Msg)
+	}
+	return errors.Errorf("output line %d:%d: %s (template %d:%d)", pos.Line, pos.Column, list[0].Msg, line, column)
+}
+
+// templatePosition returns the position in the template that produced the output at offset.
+// Output of text parts is mapped exactly, output of code is mapped to the code part that follows the last text part.
+func templatePosition(prog *program, segments []outputSegment, src []byte, offset int) (line, column int, ok bool) {
+	i := sort.Search(len(segments), func(i int) bool {
+		return segments[i].offset > offset
+	}) - 1
+	if i < 0 {
+		return 0, 0, false
+	}
+	seg := segments[i]
+	if !seg.code {
+		part := prog.sources[seg.part]
+		line, column = advancePosition(part.Line, part.Column, src[seg.offset:offset])
+		return line, column, true
+	}
+	for j := seg.part + 1; j < len(prog.sources); j++ {
+		if prog.sources[j].Type == codebuffer.CodePartType {
+			return prog.sources[j].Line, prog.sources[j].Column, true
+		}
+	}
+	return 0, 0, false
+}
+
+// fixImports adds imports for standard packages that are referenced but not imported
+// and removes imports that are not used.
+func fixImports(fset *token.FileSet, file *ast.File, src []byte) []byte {
+	// the parser does not resolve package names, so every use of a package is unresolved
+	used := make(map[string]bool)
+	for _, ident := range file.Unresolved {
+		used[ident.Name] = true
+	}
+	selectors := make(map[string]map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+			if selectors[x.Name] == nil {
+				selectors[x.Name] = make(map[string]bool)
+			}
+			selectors[x.Name][sel.Sel.Name] = true
+		}
+		return true
+	})
+
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+	offset := func(p token.Pos) int {
+		return fset.Position(p).Offset
+	}
+
+	imported := make(map[string]bool)
+	var block *ast.GenDecl
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		removed := 0
+		for _, spec := range gen.Specs {
+			spec := spec.(*ast.ImportSpec)
+			name, known := importName(spec)
+			imported[name] = true
+			if !known || used[name] {
+				continue
+			}
+			removed++
+			if gen.Lparen.IsValid() {
+				// remove the line ending too, a blank line would split the import block into groups
+				end := offset(spec.End())
+				if end < len(src) && src[end] == '\n' {
+					end++
+				}
+				edits = append(edits, edit{start: offset(spec.Pos()), end: end})
+			}
+		}
+		switch {
+		case removed == len(gen.Specs):
+			// drop the whole declaration, instead of leaving an empty import block
+			if gen.Lparen.IsValid() {
+				edits = edits[:len(edits)-removed]
+			}
+			edits = append(edits, edit{start: offset(gen.Pos()), end: offset(gen.End())})
+		case block == nil && gen.Lparen.IsValid():
+			block = gen
+		}
+	}
+
+	var missing []string
+	for name, sels := range selectors {
+		if imported[name] {
+			continue
+		}
+		if importPath := stdlibImport(name, sels); importPath != "" {
+			missing = append(missing, strconv.Quote(importPath))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		if block != nil {
+			edits = append(edits, edit{
+				start: offset(block.Lparen) + 1,
+				end:   offset(block.Lparen) + 1,
+				text:  "\n" + strings.Join(missing, "\n"),
+			})
+		} else {
+			decl := "import " + missing[0]
+			if len(missing) > 1 {
+				decl = "import (\n" + strings.Join(missing, "\n") + "\n)"
+			}
+			edits = append(edits, edit{
+				start: offset(file.Name.End()),
+				end:   offset(file.Name.End()),
+				text:  "\n\n" + decl,
+			})
+		}
+	}
+	if len(edits) == 0 {
+		return src
+	}
+
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	out := append([]byte(nil), src...)
+	for _, e := range edits {
+		out = append(out[:e.start], append([]byte(e.text), out[e.end:]...)...)
+	}
+	return bytes.TrimLeft(out, "\n")
+}
+
+// importName returns the name of an imported package, known is false if the name can not be determined
+// (the package is not a standard package) or the import must not be removed (blank and dot imports).
+func importName(spec *ast.ImportSpec) (name string, known bool) {
+	importPath, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return "", false
+	}
+	if spec.Name != nil {
+		return spec.Name.Name, spec.Name.Name != "_" && spec.Name.Name != "."
+	}
+	name = path.Base(importPath)
+	_, known = stdlib.Symbols[importPath+"/"+name]
+	return name, known
+}
+
+// stdlibImport returns the import path of the standard package with the specified name that exports all selectors.
+func stdlibImport(name string, selectors map[string]bool) string {
+	candidates := stdlibPackages[name]
+	if preferred, ok := preferredImports[name]; ok {
+		candidates = append([]string{preferred}, candidates...)
+	}
+	for _, importPath := range candidates {
+		symbols, ok := stdlib.Symbols[importPath+"/"+name]
+		if !ok {
+			continue
+		}
+		exportsAll := true
+		for sel := range selectors {
+			if _, ok := symbols[sel]; !ok {
+				exportsAll = false
+				break
+			}
+		}
+		if exportsAll {
+			return importPath
+		}
+	}
+	return ""
+}
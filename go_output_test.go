@@ -0,0 +1,84 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+func TestGoOutput(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Template string
+		Expect   string
+	}{
+		{
+			"Format",
+			"<$ import \"strconv\" $>package main\nfunc   main( ) {\n<$ for _, s := range []string{\"a\", \"b\"} { $>println(<$= strconv.Quote(s) $>)\n<$ } $>}\n",
+			"package main\n\nfunc main() {\n\tprintln(\"a\")\n\tprintln(\"b\")\n}\n",
+		},
+		{
+			"Add imports",
+			"package main\nfunc main() { fmt.Println(strings.ToUpper(\"a\"), rand.Intn(2)) }\n",
+			"package main\n\nimport (\n\t\"fmt\"\n\t\"math/rand\"\n\t\"strings\"\n)\n\nfunc main() { fmt.Println(strings.ToUpper(\"a\"), rand.Intn(2)) }\n",
+		},
+		{
+			"Add imports to block",
+			"package main\nimport (\n\t\"fmt\"\n)\nfunc main() { fmt.Println(strings.ToUpper(\"a\")) }\n",
+			"package main\n\nimport (\n\t\"fmt\"\n\t\"strings\"\n)\n\nfunc main() { fmt.Println(strings.ToUpper(\"a\")) }\n",
+		},
+		{
+			"Remove imports",
+			"package main\nimport \"os\"\nimport (\n\t\"fmt\"\n\t\"strings\"\n\t_ \"embed\"\n\tacme \"example.com/acme\"\n)\nfunc main() { fmt.Println() }\n",
+			"package main\n\nimport (\n\t_ \"embed\"\n\t\"fmt\"\n)\n\nfunc main() { fmt.Println() }\n",
+		},
+		{
+			"Keep unknown imports",
+			"package main\nimport \"example.com/acme\"\nfunc main() { acme.Run() }\n",
+			"package main\n\nimport \"example.com/acme\"\n\nfunc main() { acme.Run() }\n",
+		},
+		{
+			"Local identifiers",
+			"package main\nfunc main() { var strings struct{ A int }; println(strings.A) }\n",
+			"package main\n\nfunc main() { var strings struct{ A int }; println(strings.A) }\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			template := MustNew(interp.Options{}, stdlib.Symbols)
+			template.GoOutput = true
+			template.MustParseString(test.Template)
+
+			var buf bytes.Buffer
+			template.MustExec(&buf, nil)
+			require.Equal(t, test.Expect, buf.String())
+		})
+	}
+}
+
+func TestGoOutputSyntaxError(t *testing.T) {
+	t.Run("Text", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols)
+		template.GoOutput = true
+		template.MustParseString("package main\n<$= \"func main() {}\" $>\nfunc a() {\n\treturn 1 +\n}\n")
+
+		_, err := template.Exec(&bytes.Buffer{}, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "output line 5:1: expected operand, found '}' (template 5:1)")
+		require.Contains(t, err.Error(), "error during formatting of go output")
+	})
+
+	t.Run("Code", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols)
+		template.GoOutput = true
+		template.MustParseString("package main\n\nfunc main() {\n\t<$= \"if {\" $>\n}\n")
+
+		_, err := template.Exec(&bytes.Buffer{}, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "(template 4:4)")
+	})
+}
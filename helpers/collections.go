@@ -0,0 +1,364 @@
+package helpers
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Group is a group of items that share the same key, see GroupBy.
+type Group struct {
+	Key   interface{}
+	Items []interface{}
+}
+
+// LoopItem is an item of a slice with loop metadata, see Range.
+type LoopItem struct {
+	Index int
+	Value interface{}
+	First bool
+	Last  bool
+	Odd   bool
+	Even  bool
+}
+
+// SortBy returns a copy of the slice, stable sorted by the field.
+// The field can be a struct field, a map key or a path of them separated by dots (e.g. "Address.City"),
+// prefix the field with a "-" to sort in descending order.
+// The result has the same type as the slice:
+//    for _, user := range helpers.SortBy(context.Users, "-Age").([]User) { ... }
+func SortBy(slice interface{}, field string) interface{} {
+	v := sliceValue(slice)
+	if !v.IsValid() {
+		return slice
+	}
+	desc := strings.HasPrefix(field, "-")
+	field = strings.TrimPrefix(field, "-")
+
+	result := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), v.Len(), v.Len())
+	reflect.Copy(result, v)
+	keys := make([]interface{}, result.Len())
+	for i := range keys {
+		keys[i] = fieldValue(result.Index(i), field)
+	}
+	swap := reflect.Swapper(result.Interface())
+	sort.Stable(&sorter{
+		len: result.Len(),
+		less: func(i, j int) bool {
+			if desc {
+				return compare(keys[j], keys[i]) < 0
+			}
+			return compare(keys[i], keys[j]) < 0
+		},
+		swap: func(i, j int) {
+			keys[i], keys[j] = keys[j], keys[i]
+			swap(i, j)
+		},
+	})
+	return result.Interface()
+}
+
+// GroupBy groups the items of the slice by the field (see SortBy), the groups are sorted by their key.
+func GroupBy(slice interface{}, field string) []Group {
+	v := sliceValue(slice)
+	if !v.IsValid() {
+		return nil
+	}
+	var groups []Group
+	index := make(map[interface{}]int)
+	for i := 0; i < v.Len(); i++ {
+		item := v.Index(i)
+		key := fieldValue(item, field)
+		mapKey := key
+		if key != nil && !reflect.TypeOf(key).Comparable() {
+			mapKey = fmt.Sprint(key)
+		}
+		n, ok := index[mapKey]
+		if !ok {
+			n = len(groups)
+			index[mapKey] = n
+			groups = append(groups, Group{Key: key})
+		}
+		groups[n].Items = append(groups[n].Items, item.Interface())
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return compare(groups[i].Key, groups[j].Key) < 0
+	})
+	return groups
+}
+
+// Filter returns the items of the slice for which fn returns true, fn must be a func(T) bool.
+// The result has the same type as the slice.
+func Filter(slice, fn interface{}) interface{} {
+	v := sliceValue(slice)
+	f := reflect.ValueOf(fn)
+	if !v.IsValid() || f.Kind() != reflect.Func {
+		return slice
+	}
+	result := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		out := f.Call([]reflect.Value{callArg(f, v.Index(i))})
+		if len(out) > 0 && out[0].Kind() == reflect.Bool && out[0].Bool() {
+			result = reflect.Append(result, v.Index(i))
+		}
+	}
+	return result.Interface()
+}
+
+// Where returns the items of the slice whose field (see SortBy) equals value.
+// The result has the same type as the slice.
+func Where(slice interface{}, field string, value interface{}) interface{} {
+	v := sliceValue(slice)
+	if !v.IsValid() {
+		return slice
+	}
+	result := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if compare(fieldValue(v.Index(i), field), value) == 0 {
+			result = reflect.Append(result, v.Index(i))
+		}
+	}
+	return result.Interface()
+}
+
+// Map calls fn for every item of the slice and returns the results, fn must be a func(T) R.
+func Map(slice, fn interface{}) []interface{} {
+	v := sliceValue(slice)
+	f := reflect.ValueOf(fn)
+	if !v.IsValid() || f.Kind() != reflect.Func {
+		return nil
+	}
+	result := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		out := f.Call([]reflect.Value{callArg(f, v.Index(i))})
+		if len(out) == 0 {
+			result = append(result, nil)
+			continue
+		}
+		result = append(result, out[0].Interface())
+	}
+	return result
+}
+
+// Pluck returns the field (see SortBy) of every item of the slice.
+func Pluck(slice interface{}, field string) []interface{} {
+	v := sliceValue(slice)
+	if !v.IsValid() {
+		return nil
+	}
+	result := make([]interface{}, v.Len())
+	for i := range result {
+		result[i] = fieldValue(v.Index(i), field)
+	}
+	return result
+}
+
+// Chunk splits the slice into chunks of the size, the last chunk can be smaller.
+func Chunk(slice interface{}, size int) [][]interface{} {
+	v := sliceValue(slice)
+	if !v.IsValid() || size <= 0 {
+		return nil
+	}
+	var result [][]interface{}
+	for i := 0; i < v.Len(); i += size {
+		end := i + size
+		if end > v.Len() {
+			end = v.Len()
+		}
+		chunk := make([]interface{}, 0, end-i)
+		for j := i; j < end; j++ {
+			chunk = append(chunk, v.Index(j).Interface())
+		}
+		result = append(result, chunk)
+	}
+	return result
+}
+
+// First returns the first item of the slice, nil is returned if the slice is empty.
+func First(slice interface{}) interface{} {
+	v := sliceValue(slice)
+	if !v.IsValid() || v.Len() == 0 {
+		return nil
+	}
+	return v.Index(0).Interface()
+}
+
+// Last returns the last item of the slice, nil is returned if the slice is empty.
+func Last(slice interface{}) interface{} {
+	v := sliceValue(slice)
+	if !v.IsValid() || v.Len() == 0 {
+		return nil
+	}
+	return v.Index(v.Len() - 1).Interface()
+}
+
+// Keys returns the sorted keys of the map.
+func Keys(m interface{}) []interface{} {
+	v := mapValue(m)
+	if !v.IsValid() {
+		return nil
+	}
+	keys := make([]interface{}, 0, v.Len())
+	for _, key := range sortedKeys(v) {
+		keys = append(keys, key.Interface())
+	}
+	return keys
+}
+
+// Values returns the values of the map, sorted by their keys.
+func Values(m interface{}) []interface{} {
+	v := mapValue(m)
+	if !v.IsValid() {
+		return nil
+	}
+	values := make([]interface{}, 0, v.Len())
+	for _, key := range sortedKeys(v) {
+		values = append(values, v.MapIndex(key).Interface())
+	}
+	return values
+}
+
+// Range returns the items of the slice with loop metadata:
+//    for _, item := range helpers.Range(context.Users) {
+//        if item.Odd { ... }
+//    }
+func Range(slice interface{}) []LoopItem {
+	v := sliceValue(slice)
+	if !v.IsValid() {
+		return nil
+	}
+	items := make([]LoopItem, v.Len())
+	for i := range items {
+		items[i] = LoopItem{
+			Index: i,
+			Value: v.Index(i).Interface(),
+			First: i == 0,
+			Last:  i == v.Len()-1,
+			Odd:   i%2 == 1,
+			Even:  i%2 == 0,
+		}
+	}
+	return items
+}
+
+// sliceValue returns the slice or array value of v, an invalid value is returned if v is no slice or array.
+func sliceValue(v interface{}) reflect.Value {
+	rv := indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return reflect.Value{}
+	}
+	return rv
+}
+
+// mapValue returns the map value of v, an invalid value is returned if v is no map.
+func mapValue(v interface{}) reflect.Value {
+	rv := indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Map {
+		return reflect.Value{}
+	}
+	return rv
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func sortedKeys(m reflect.Value) []reflect.Value {
+	keys := m.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return compare(keys[i].Interface(), keys[j].Interface()) < 0
+	})
+	return keys
+}
+
+// fieldValue returns the value of the field path of item.
+func fieldValue(item reflect.Value, field string) interface{} {
+	if field == "" {
+		if !item.IsValid() || !item.CanInterface() {
+			return nil
+		}
+		return item.Interface()
+	}
+	keys := strings.Split(field, ".")
+	args := make([]interface{}, len(keys))
+	for i := range keys {
+		args[i] = keys[i]
+	}
+	return Get(item.Interface(), args...)
+}
+
+// callArg converts v to the type of the first parameter of f if necessary.
+func callArg(f, v reflect.Value) reflect.Value {
+	if f.Type().NumIn() == 0 {
+		return v
+	}
+	in := f.Type().In(0)
+	if v.Type().AssignableTo(in) {
+		return v
+	}
+	if v.Kind() == reflect.Interface && !v.IsNil() && v.Elem().Type().AssignableTo(in) {
+		return v.Elem()
+	}
+	return v
+}
+
+// compare compares a and b, numbers, strings, bools and times are compared by their value,
+// all other values are compared by their string representation. nil is less than all other values.
+func compare(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			return compareOrdered(fa < fb, fa > fb)
+		}
+	}
+	ta, okA := a.(time.Time)
+	tb, okB := b.(time.Time)
+	if okA && okB {
+		return compareOrdered(ta.Before(tb), ta.After(tb))
+	}
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() == reflect.Bool && vb.Kind() == reflect.Bool {
+		return compareOrdered(!va.Bool() && vb.Bool(), va.Bool() && !vb.Bool())
+	}
+	if va.Kind() == reflect.String && vb.Kind() == reflect.String {
+		return strings.Compare(va.String(), vb.String())
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// sorter implements sort.Interface with functions.
+type sorter struct {
+	len  int
+	less func(i, j int) bool
+	swap func(i, j int)
+}
+
+func (s *sorter) Len() int           { return s.len }
+func (s *sorter) Less(i, j int) bool { return s.less(i, j) }
+func (s *sorter) Swap(i, j int)      { s.swap(i, j) }
@@ -0,0 +1,40 @@
+package helpers
+
+import (
+	"encoding/json"
+	"html"
+	"net/url"
+)
+
+// EscapeHTML escapes the special html characters in s.
+func EscapeHTML(s string) string {
+	return html.EscapeString(s)
+}
+
+// EscapeURL escapes s so it can be used as a query parameter.
+func EscapeURL(s string) string {
+	return url.QueryEscape(s)
+}
+
+// EscapePath escapes s so it can be used as a path segment.
+func EscapePath(s string) string {
+	return url.PathEscape(s)
+}
+
+// JSON returns the json encoding of v, an empty string is returned if v cannot be encoded.
+func JSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// IndentedJSON is like JSON, except the output is indented with two spaces.
+func IndentedJSON(v interface{}) string {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,135 @@
+package helpers
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatNumber formats the number v with the specified amount of decimals and a comma as thousands separator:
+// 1234567.891 => "1,234,567.89".
+func FormatNumber(v interface{}, decimals int) string {
+	f, ok := toFloat(v)
+	if !ok {
+		return ""
+	}
+	if decimals < 0 {
+		decimals = 0
+	}
+	s := strconv.FormatFloat(math.Abs(f), 'f', decimals, 64)
+	integer, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		integer, fraction = s[:i], s[i:]
+	}
+
+	var sb strings.Builder
+	if f < 0 && strings.Trim(s, "0.") != "" {
+		sb.WriteByte('-')
+	}
+	for i := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteByte(integer[i])
+	}
+	sb.WriteString(fraction)
+	return sb.String()
+}
+
+// ByteSize formats n bytes in a human readable form using binary units: 1536 => "1.5 KiB".
+func ByteSize(n int64) string {
+	const unit = 1024
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	f := float64(n)
+	exp := 0
+	for math.Abs(f) >= unit && exp < 6 {
+		f /= unit
+		exp++
+	}
+	s := strconv.FormatFloat(f, 'f', 1, 64)
+	s = strings.TrimSuffix(s, ".0")
+	return s + " " + "KMGTPE"[exp-1:exp] + "iB"
+}
+
+// toFloat converts a numeric value to a float64.
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() { //nolint:exhaustive // only numbers can be converted
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// FormatDate formats t with the layout, besides the go layouts the names "date" (2006-01-02),
+// "datetime" (2006-01-02 15:04:05), "time" (15:04), "rfc3339" and "rfc1123" can be used.
+// An empty string is returned for the zero time.
+func FormatDate(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	switch strings.ToLower(layout) {
+	case "date":
+		layout = "2006-01-02"
+	case "datetime":
+		layout = "2006-01-02 15:04:05"
+	case "time":
+		layout = "15:04"
+	case "rfc3339":
+		layout = time.RFC3339
+	case "rfc1123":
+		layout = time.RFC1123
+	}
+	return t.Format(layout)
+}
+
+// RelativeTime describes t relative to the current time: "3 minutes ago", "in 2 days".
+func RelativeTime(t time.Time) string {
+	return RelativeTo(t, time.Now())
+}
+
+// RelativeTo describes t relative to now: "3 minutes ago", "in 2 days".
+func RelativeTo(t, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	if d < 10*time.Second {
+		return "just now"
+	}
+
+	units := []struct {
+		d    time.Duration
+		name string
+	}{
+		{365 * 24 * time.Hour, "year"},
+		{30 * 24 * time.Hour, "month"},
+		{7 * 24 * time.Hour, "week"},
+		{24 * time.Hour, "day"},
+		{time.Hour, "hour"},
+		{time.Minute, "minute"},
+		{time.Second, "second"},
+	}
+	var s string
+	for _, u := range units {
+		if d >= u.d {
+			n := int(d / u.d)
+			s = strconv.Itoa(n) + " " + Pluralize(n, u.name, u.name+"s")
+			break
+		}
+	}
+	if future {
+		return "in " + s
+	}
+	return s + " ago"
+}
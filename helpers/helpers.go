@@ -0,0 +1,67 @@
+// Package helpers provides functions that are commonly used in templates.
+// The functions can be imported in templates with the ImportPath, as soon as the Symbols are used:
+//    template := yaegi_template.MustNew(yaegi_template.DefaultOptions(), yaegi_template.DefaultSymbols()...)
+//    template.MustParseString(`<$ import "yaegi-template/helpers" $><$= helpers.ByteSize(context.Size) $>`)
+package helpers
+
+import (
+	"reflect"
+
+	"github.com/traefik/yaegi/interp"
+)
+
+// ImportPath is the path that is used to import the helpers inside of templates.
+const ImportPath = "yaegi-template/helpers"
+
+// Symbols are the exports of the helpers package, they can be passed to New() or Use().
+var Symbols = interp.Exports{
+	ImportPath + "/helpers": map[string]reflect.Value{
+		// strings
+		"Truncate":  reflect.ValueOf(Truncate),
+		"Slugify":   reflect.ValueOf(Slugify),
+		"Pluralize": reflect.ValueOf(Pluralize),
+		"Initials":  reflect.ValueOf(Initials),
+		"Indent":    reflect.ValueOf(Indent),
+
+		// encoding
+		"EscapeHTML":   reflect.ValueOf(EscapeHTML),
+		"EscapeURL":    reflect.ValueOf(EscapeURL),
+		"EscapePath":   reflect.ValueOf(EscapePath),
+		"JSON":         reflect.ValueOf(JSON),
+		"IndentedJSON": reflect.ValueOf(IndentedJSON),
+
+		// numbers
+		"FormatNumber": reflect.ValueOf(FormatNumber),
+		"ByteSize":     reflect.ValueOf(ByteSize),
+
+		// time
+		"FormatDate":   reflect.ValueOf(FormatDate),
+		"RelativeTime": reflect.ValueOf(RelativeTime),
+		"RelativeTo":   reflect.ValueOf(RelativeTo),
+
+		// values
+		"Default":  reflect.ValueOf(Default),
+		"Coalesce": reflect.ValueOf(Coalesce),
+		"IsZero":   reflect.ValueOf(IsZero),
+		"Get":      reflect.ValueOf(Get),
+		"GetOr":    reflect.ValueOf(GetOr),
+
+		// collections
+		"SortBy":  reflect.ValueOf(SortBy),
+		"GroupBy": reflect.ValueOf(GroupBy),
+		"Filter":  reflect.ValueOf(Filter),
+		"Where":   reflect.ValueOf(Where),
+		"Map":     reflect.ValueOf(Map),
+		"Pluck":   reflect.ValueOf(Pluck),
+		"Chunk":   reflect.ValueOf(Chunk),
+		"First":   reflect.ValueOf(First),
+		"Last":    reflect.ValueOf(Last),
+		"Keys":    reflect.ValueOf(Keys),
+		"Values":  reflect.ValueOf(Values),
+		"Range":   reflect.ValueOf(Range),
+
+		// types
+		"Group":    reflect.ValueOf((*Group)(nil)),
+		"LoopItem": reflect.ValueOf((*LoopItem)(nil)),
+	},
+}
@@ -0,0 +1,192 @@
+package helpers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrings(t *testing.T) {
+	require.Equal(t, "Hello", Truncate("Hello", 5))
+	require.Equal(t, "Hel…", Truncate("Hello", 3))
+	require.Equal(t, "äö…", Truncate("äöü", 2))
+	require.Equal(t, "…", Truncate("Hello", -1))
+
+	require.Equal(t, "hello-world", Slugify("Hello, World!"))
+	require.Equal(t, "a-b-c", Slugify("  --a  b__c--  "))
+	require.Equal(t, "größe-42", Slugify("Größe 42"))
+
+	require.Equal(t, "item", Pluralize(1, "item", "items"))
+	require.Equal(t, "items", Pluralize(0, "item", "items"))
+	require.Equal(t, "items", Pluralize(2, "item", "items"))
+
+	require.Equal(t, "  a:\n    b: c\n\n  d", Indent(2, "a:\n  b: c\n\nd"))
+	require.Equal(t, "  a\r\n  b\r\n", Indent(2, "a\r\nb\r\n"))
+	require.Equal(t, "a", Indent(0, "a"))
+
+	require.Equal(t, "JD", Initials("joe  doe"))
+	require.Equal(t, "", Initials(""))
+}
+
+func TestEncoding(t *testing.T) {
+	require.Equal(t, "&lt;a href=&#34;x&#34;&gt;", EscapeHTML(`<a href="x">`))
+	require.Equal(t, "a+b%26c", EscapeURL("a b&c"))
+	require.Equal(t, "a%20b%2Fc", EscapePath("a b/c"))
+	require.Equal(t, `{"a":[1,2]}`, JSON(map[string][]int{"a": {1, 2}}))
+	require.Equal(t, "", JSON(func() {}))
+	require.Equal(t, "{\n  \"a\": 1\n}", IndentedJSON(map[string]int{"a": 1}))
+}
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		Value    interface{}
+		Decimals int
+		Expect   string
+	}{
+		{1234567.891, 2, "1,234,567.89"},
+		{1234567, 0, "1,234,567"},
+		{-1234.5, 1, "-1,234.5"},
+		{123, 2, "123.00"},
+		{uint8(255), 0, "255"},
+		{float32(0.5), 0, "0"},
+		{-0.001, 2, "0.00"},
+		{"123", 0, ""},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.Expect, FormatNumber(test.Value, test.Decimals), "%v", test.Value)
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	require.Equal(t, "0 B", ByteSize(0))
+	require.Equal(t, "1023 B", ByteSize(1023))
+	require.Equal(t, "1 KiB", ByteSize(1024))
+	require.Equal(t, "1.5 KiB", ByteSize(1536))
+	require.Equal(t, "5.2 MiB", ByteSize(5*1024*1024+200*1024))
+	require.Equal(t, "-2 GiB", ByteSize(-2*1024*1024*1024))
+}
+
+func TestTime(t *testing.T) {
+	date := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	require.Equal(t, "2020-01-02", FormatDate(date, "date"))
+	require.Equal(t, "2020-01-02 15:04:05", FormatDate(date, "datetime"))
+	require.Equal(t, "15:04", FormatDate(date, "time"))
+	require.Equal(t, "2020-01-02T15:04:05Z", FormatDate(date, "RFC3339"))
+	require.Equal(t, "02.01.2020", FormatDate(date, "02.01.2006"))
+	require.Equal(t, "", FormatDate(time.Time{}, "date"))
+
+	require.Equal(t, "just now", RelativeTo(date, date.Add(5*time.Second)))
+	require.Equal(t, "30 seconds ago", RelativeTo(date, date.Add(30*time.Second)))
+	require.Equal(t, "1 minute ago", RelativeTo(date, date.Add(90*time.Second)))
+	require.Equal(t, "3 hours ago", RelativeTo(date, date.Add(3*time.Hour)))
+	require.Equal(t, "in 2 days", RelativeTo(date, date.Add(-50*time.Hour)))
+	require.Equal(t, "2 weeks ago", RelativeTo(date, date.AddDate(0, 0, 15)))
+	require.Equal(t, "1 year ago", RelativeTo(date, date.AddDate(1, 0, 1)))
+	require.Equal(t, "just now", RelativeTime(time.Now()))
+}
+
+func TestValues(t *testing.T) {
+	require.True(t, IsZero(nil))
+	require.True(t, IsZero(""))
+	require.True(t, IsZero(0))
+	require.True(t, IsZero([]int{}))
+	require.True(t, IsZero(map[string]int{}))
+	require.True(t, IsZero(time.Time{}))
+	require.False(t, IsZero("a"))
+	require.False(t, IsZero(true))
+
+	require.Equal(t, "fallback", Default("", "fallback"))
+	require.Equal(t, "value", Default("value", "fallback"))
+	require.Equal(t, 2, Coalesce(0, nil, 2, 3))
+	require.Nil(t, Coalesce(0, ""))
+
+	type Address struct {
+		City string
+	}
+	type User struct {
+		Name      string
+		Addresses []*Address
+		Tags      map[string]string
+		secret    string
+	}
+	user := &User{
+		Name:      "Joe",
+		Addresses: []*Address{{City: "Berlin"}},
+		Tags:      map[string]string{"role": "admin"},
+		secret:    "x",
+	}
+	require.Equal(t, "Joe", Get(user, "Name"))
+	require.Equal(t, "Berlin", Get(user, "Addresses", 0, "City"))
+	require.Equal(t, "Berlin", Get(user, "Addresses", "0", "City"))
+	require.Equal(t, "admin", Get(user, "Tags", "role"))
+	require.Nil(t, Get(user, "Addresses", 1, "City"))
+	require.Nil(t, Get(user, "Tags", "missing"))
+	require.Nil(t, Get(user, "Tags", 1))
+	require.Nil(t, Get(user, "secret"))
+	require.Nil(t, Get(user, "Unknown"))
+	require.Nil(t, Get(nil, "Name"))
+	require.Nil(t, Get((*User)(nil), "Name"))
+	require.Equal(t, user, Get(user))
+	require.Equal(t, "guest", GetOr(user, "guest", "Tags", "missing"))
+	require.Equal(t, "admin", GetOr(user, "guest", "Tags", "role"))
+	require.Nil(t, Get(map[error]string{}, errors.New("x")))
+}
+
+type person struct {
+	Name string
+	Age  int
+	City string
+}
+
+var people = []person{
+	{"Joe", 42, "Berlin"},
+	{"Alice", 23, "Paris"},
+	{"Bob", 42, "Berlin"},
+	{"Eve", 31, "London"},
+}
+
+func TestCollections(t *testing.T) {
+	require.Equal(t, []person{people[1], people[3], people[0], people[2]}, SortBy(people, "Age"))
+	require.Equal(t, []person{people[0], people[2], people[3], people[1]}, SortBy(people, "-Age"))
+	require.Equal(t, []person{people[1], people[2], people[3], people[0]}, SortBy(&people, "Name"))
+	require.Equal(t, "Joe", people[0].Name, "SortBy must not modify the slice")
+	require.Equal(t, []interface{}{"a", nil, 2}, SortBy([]interface{}{"a", nil, 2}, "Unknown"))
+	require.Equal(t, 1, SortBy(1, "Age"))
+
+	require.Equal(t, []Group{
+		{Key: "Berlin", Items: []interface{}{people[0], people[2]}},
+		{Key: "London", Items: []interface{}{people[3]}},
+		{Key: "Paris", Items: []interface{}{people[1]}},
+	}, GroupBy(people, "City"))
+
+	require.Equal(t, []person{people[0], people[2]}, Filter(people, func(p person) bool { return p.Age > 40 }))
+	require.Equal(t, []person{people[3]}, Where(people, "City", "London"))
+	require.Equal(t, []person{people[0], people[2]}, Where(people, "Age", 42.0))
+
+	require.Equal(t, []interface{}{"JOE", "ALICE", "BOB", "EVE"}, Map(people, func(p person) string { return strings.ToUpper(p.Name) }))
+	require.Equal(t, []interface{}{"Joe", "Alice", "Bob", "Eve"}, Pluck(people, "Name"))
+
+	require.Equal(t, [][]interface{}{{1, 2}, {3, 4}, {5}}, Chunk([]int{1, 2, 3, 4, 5}, 2))
+	require.Nil(t, Chunk([]int{1, 2}, 0))
+
+	require.Equal(t, people[0], First(people))
+	require.Equal(t, people[3], Last(people))
+	require.Nil(t, First([]int{}))
+	require.Nil(t, Last(nil))
+
+	m := map[string]int{"c": 3, "a": 1, "b": 2}
+	require.Equal(t, []interface{}{"a", "b", "c"}, Keys(m))
+	require.Equal(t, []interface{}{1, 2, 3}, Values(m))
+	require.Equal(t, []interface{}{2, 10, 100}, Keys(map[int]bool{100: true, 2: true, 10: true}))
+	require.Nil(t, Keys([]int{}))
+
+	require.Equal(t, []LoopItem{
+		{Index: 0, Value: "a", First: true, Last: false, Odd: false, Even: true},
+		{Index: 1, Value: "b", First: false, Last: false, Odd: true, Even: false},
+		{Index: 2, Value: "c", First: false, Last: true, Odd: false, Even: true},
+	}, Range([]string{"a", "b", "c"}))
+	require.Nil(t, Range(nil))
+}
@@ -0,0 +1,72 @@
+package helpers
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Truncate shortens s to n runes, an ellipsis is appended if s was shortened.
+func Truncate(s string, n int) string {
+	if n < 0 {
+		n = 0
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
+
+// Slugify converts s into a lowercase, url friendly slug: "Hello, World!" => "hello-world".
+func Slugify(s string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && sb.Len() > 0 {
+				sb.WriteRune('-')
+			}
+			dash = false
+			sb.WriteRune(r)
+			continue
+		}
+		dash = true
+	}
+	return sb.String()
+}
+
+// Pluralize returns singular if n is 1, plural otherwise.
+func Pluralize(n int, singular, plural string) string {
+	if n == 1 || n == -1 {
+		return singular
+	}
+	return plural
+}
+
+// Initials returns the uppercase first letters of the words in s: "Joe Doe" => "JD".
+func Initials(s string) string {
+	var sb strings.Builder
+	for _, word := range strings.Fields(s) {
+		r, _ := utf8.DecodeRuneInString(word)
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+	return sb.String()
+}
+
+// Indent prefixes all lines of s, that are not empty, with n spaces.
+//    helpers.Indent(2, "a:\n  b: c") => "  a:\n    b: c"
+func Indent(n int, s string) string {
+	if n <= 0 {
+		return s
+	}
+	prefix := strings.Repeat(" ", n)
+	lines := strings.SplitAfter(s, "\n")
+	var sb strings.Builder
+	for _, line := range lines {
+		if strings.TrimRight(line, "\r\n") != "" {
+			sb.WriteString(prefix)
+		}
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
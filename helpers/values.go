@@ -0,0 +1,119 @@
+package helpers
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// IsZero returns true if v is nil or the zero value of its type, empty slices and maps are also zero.
+func IsZero(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return true
+	}
+	switch rv.Kind() { //nolint:exhaustive // all other kinds are compared with their zero value
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String, reflect.Chan:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
+
+// Default returns fallback if v is zero (see IsZero), otherwise v.
+func Default(v, fallback interface{}) interface{} {
+	if IsZero(v) {
+		return fallback
+	}
+	return v
+}
+
+// Coalesce returns the first value that is not zero (see IsZero), nil is returned if all values are zero.
+func Coalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !IsZero(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// Get looks up the keys in v, v can be a map, a slice, an array, a struct or a pointer to one of them.
+// Multiple keys look up nested values:
+//    helpers.Get(context, "User", "Addresses", 0, "City")
+// nil is returned if a key does not exist.
+func Get(v interface{}, keys ...interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	for _, key := range keys {
+		var ok bool
+		rv, ok = lookup(rv, key)
+		if !ok {
+			return nil
+		}
+	}
+	if !rv.IsValid() || !rv.CanInterface() {
+		return nil
+	}
+	return rv.Interface()
+}
+
+// GetOr is like Get, except it returns fallback if the value does not exist or is zero (see IsZero).
+func GetOr(v, fallback interface{}, keys ...interface{}) interface{} {
+	return Default(Get(v, keys...), fallback)
+}
+
+func lookup(v reflect.Value, key interface{}) (reflect.Value, bool) {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return reflect.Value{}, false
+	}
+
+	switch v.Kind() { //nolint:exhaustive // other kinds do not have keys
+	case reflect.Map:
+		k := reflect.ValueOf(key)
+		if !k.IsValid() {
+			return reflect.Value{}, false
+		}
+		if !k.Type().AssignableTo(v.Type().Key()) {
+			// allow named types, e.g. a string for a map[Key]..., but no conversions between kinds (int => string)
+			if k.Kind() != v.Type().Key().Kind() || !k.Type().ConvertibleTo(v.Type().Key()) {
+				return reflect.Value{}, false
+			}
+			k = k.Convert(v.Type().Key())
+		}
+		value := v.MapIndex(k)
+		return value, value.IsValid()
+	case reflect.Slice, reflect.Array, reflect.String:
+		i, ok := toIndex(key)
+		if !ok || i < 0 || i >= v.Len() {
+			return reflect.Value{}, false
+		}
+		return v.Index(i), true
+	case reflect.Struct:
+		name, ok := key.(string)
+		if !ok {
+			return reflect.Value{}, false
+		}
+		field, ok := v.Type().FieldByName(name)
+		if !ok || field.PkgPath != "" {
+			return reflect.Value{}, false
+		}
+		return v.FieldByIndex(field.Index), true
+	}
+	return reflect.Value{}, false
+}
+
+func toIndex(key interface{}) (int, bool) {
+	switch k := key.(type) {
+	case int:
+		return k, true
+	case string:
+		i, err := strconv.Atoi(k)
+		return i, err == nil
+	}
+	f, ok := toFloat(key)
+	return int(f), ok && f == float64(int(f))
+}
@@ -0,0 +1,572 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// SafeHTML is a string of trusted markup, the HTMLEscaper will not escape it when it is written
+// with an expression block:
+//    <$= SafeHTML("<b>Hello</b>") $>
+type SafeHTML string
+
+// htmlState represents the html context the output is currently written to.
+type htmlState uint8
+
+const (
+	htmlStateText htmlState = iota
+	htmlStateTagName
+	htmlStateTag
+	htmlStateAttrName
+	htmlStateAfterAttrName
+	htmlStateBeforeAttrValue
+	htmlStateAttrValue
+	htmlStateComment
+	htmlStateRawText
+)
+
+// htmlAttrType represents the type of the attribute value.
+type htmlAttrType uint8
+
+const (
+	htmlAttrNormal htmlAttrType = iota
+	htmlAttrURL
+	htmlAttrJS
+	htmlAttrCSS
+)
+
+// HTMLEscaper is an Escaper that tracks the html context of the literal text parts and escapes the
+// output of the code blocks accordingly, similar to html/template.
+// The following contexts are supported: element bodies, attribute values (quoted and unquoted), url attributes,
+// event handler attributes (js), style attributes, script and style elements, textarea and title elements and
+// comments.
+// Values of the type SafeHTML, that are written in an element body, will not be escaped.
+type HTMLEscaper struct {
+	state htmlState
+	// tag is the name of the current tag.
+	tag strings.Builder
+	// closingTag is true if the current tag is a closing tag.
+	closingTag bool
+	// rawTextTag is the name of the element (script, style, textarea, title) whose content is currently written.
+	rawTextTag string
+	// rawText holds the content of the raw text element, used to find the closing tag.
+	rawText   []byte
+	attrName  strings.Builder
+	attrType  htmlAttrType
+	attrQuote byte
+	attrValue []byte
+	comment   []byte
+	jsQuote   byte
+	jsEscaped bool
+	// jsComment is '/' inside of a js line comment and '*' inside of a js block comment.
+	jsComment byte
+	// jsPrev is the previous js character, it is used to find the start and the end of comments.
+	jsPrev byte
+	// jsTemplates holds the brace depths outside of the open template literal substitutions (${...}),
+	// jsBraces is the brace depth of the current js code.
+	jsTemplates []int
+	jsBraces    int
+}
+
+// NewHTMLEscaper creates a new HTMLEscaper.
+func NewHTMLEscaper() *HTMLEscaper {
+	return &HTMLEscaper{}
+}
+
+// Reset resets the escaper to the initial (element body) context.
+func (e *HTMLEscaper) Reset() {
+	*e = HTMLEscaper{}
+}
+
+// Text feeds literal text to the escaper, so it can keep track of the html context.
+func (e *HTMLEscaper) Text(p []byte) {
+	for _, c := range p {
+		e.next(c)
+	}
+}
+
+// Escape escapes p for the current html context.
+func (e *HTMLEscaper) Escape(p []byte) []byte {
+	// the output separates the text before and after it, e.g. 1/<$= x $>/2 is no comment
+	e.jsPrev = 0
+	switch e.state {
+	case htmlStateText, htmlStateComment:
+		return []byte(htmlEscape(string(p)))
+	case htmlStateRawText:
+		switch e.rawTextTag {
+		case "script":
+			return e.escapeJS(string(p))
+		case "style":
+			return []byte(cssEscape(string(p)))
+		default:
+			return []byte(htmlEscape(string(p)))
+		}
+	case htmlStateBeforeAttrValue:
+		// the output starts an unquoted attribute value
+		e.state = htmlStateAttrValue
+		e.attrQuote = 0
+		return e.escapeAttr(p)
+	case htmlStateAttrValue:
+		return e.escapeAttr(p)
+	case htmlStateTagName, htmlStateTag, htmlStateAttrName, htmlStateAfterAttrName:
+		// output inside a tag is only allowed to be an attribute name
+		if isSafeAttrName(string(p)) {
+			return p
+		}
+		return []byte("ZgotmplZ")
+	}
+	return []byte(htmlEscape(string(p)))
+}
+
+// escapeValue escapes a value that was written by an expression block or by an implicit return.
+func (e *HTMLEscaper) escapeValue(v reflect.Value, formatted string) []byte {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	if safe, ok := v.Interface().(SafeHTML); ok {
+		if e.state == htmlStateText {
+			e.Text([]byte(safe))
+			return []byte(safe)
+		}
+		// trusted markup is only trusted in an element body
+		return e.Escape([]byte(safe))
+	}
+	e.jsPrev = 0
+	if e.inJS() && e.jsQuote == 0 && e.jsComment == 0 {
+		// outside of a js string, write the value as a js (json) value
+		s := "null"
+		if b, err := json.Marshal(v.Interface()); err == nil {
+			s = jsEscapeJSON(string(b))
+		}
+		if e.state == htmlStateAttrValue {
+			return e.attrEscape(s)
+		}
+		return []byte(s)
+	}
+	return e.Escape([]byte(formatted))
+}
+
+func (e *HTMLEscaper) inJS() bool {
+	return (e.state == htmlStateRawText && e.rawTextTag == "script") ||
+		(e.state == htmlStateAttrValue && e.attrType == htmlAttrJS)
+}
+
+func (e *HTMLEscaper) escapeAttr(p []byte) []byte {
+	var s string
+	switch e.attrType {
+	case htmlAttrURL:
+		s = e.escapeURL(string(p))
+	case htmlAttrJS:
+		s = string(e.escapeJS(string(p)))
+	case htmlAttrCSS:
+		s = cssEscape(string(p))
+	default:
+		s = string(p)
+	}
+	return e.attrEscape(s)
+}
+
+// attrEscape escapes s, that was already escaped for the attribute type, for the attribute value.
+func (e *HTMLEscaper) attrEscape(s string) []byte {
+	e.attrValue = append(e.attrValue, s...)
+	if e.attrQuote == 0 {
+		return []byte(htmlEscapeUnquoted(s))
+	}
+	return []byte(htmlEscape(s))
+}
+
+func (e *HTMLEscaper) escapeURL(s string) string {
+	if len(bytes.TrimSpace(e.attrValue)) == 0 {
+		// the output is the beginning of the url, make sure it has a safe scheme
+		if i := strings.IndexRune(s, ':'); i >= 0 && !strings.ContainsAny(s[:i], "/?#") {
+			switch strings.ToLower(strings.TrimSpace(s[:i])) {
+			case "http", "https", "mailto":
+			default:
+				return "#ZgotmplZ"
+			}
+		}
+		return urlNormalize(s)
+	}
+	if bytes.ContainsAny(e.attrValue, "?#") {
+		return url.QueryEscape(s)
+	}
+	return urlNormalize(s)
+}
+
+func (e *HTMLEscaper) escapeJS(s string) []byte {
+	if e.jsComment != 0 {
+		return []byte(jsCommentEscape(s))
+	}
+	if e.jsQuote == 0 {
+		b, err := json.Marshal(s)
+		if err != nil {
+			return []byte(`""`)
+		}
+		return []byte(jsEscapeJSON(string(b)))
+	}
+	return []byte(jsStringEscape(s))
+}
+
+// next advances the state machine by one byte of literal text.
+//nolint:gocyclo,gocognit // a state machine is easier to read in one function
+func (e *HTMLEscaper) next(c byte) {
+	switch e.state {
+	case htmlStateText:
+		if c == '<' {
+			e.state = htmlStateTagName
+			e.tag.Reset()
+			e.closingTag = false
+			e.comment = e.comment[:0]
+		}
+	case htmlStateTagName:
+		switch {
+		case c == '/' && e.tag.Len() == 0:
+			e.closingTag = true
+		case c == '!' && e.tag.Len() == 0:
+			e.comment = append(e.comment[:0], c)
+		case len(e.comment) > 0:
+			e.comment = append(e.comment, c)
+			if string(e.comment) == "!--" {
+				e.state = htmlStateComment
+				e.comment = e.comment[:0]
+			} else if len(e.comment) >= 3 || c != '-' {
+				// a doctype or some other declaration
+				e.comment = e.comment[:0]
+				e.state = htmlStateTag
+			}
+		case isASCIILetter(c) || (e.tag.Len() > 0 && (isASCIIDigit(c) || c == '-' || c == ':')):
+			e.tag.WriteByte(c)
+		case c == '>':
+			e.endTag()
+		case isHTMLSpace(c) || c == '/':
+			if e.tag.Len() == 0 {
+				// not a tag, e.g. "a < b"
+				e.state = htmlStateText
+				return
+			}
+			e.state = htmlStateTag
+		default:
+			if e.tag.Len() == 0 {
+				e.state = htmlStateText
+				return
+			}
+			e.state = htmlStateTag
+		}
+	case htmlStateTag:
+		switch {
+		case c == '>':
+			e.endTag()
+		case isHTMLSpace(c) || c == '/':
+		default:
+			e.state = htmlStateAttrName
+			e.attrName.Reset()
+			e.attrName.WriteByte(c)
+		}
+	case htmlStateAttrName:
+		switch {
+		case c == '=':
+			e.beginAttrValue()
+		case c == '>':
+			e.endTag()
+		case isHTMLSpace(c):
+			e.state = htmlStateAfterAttrName
+		case c == '/':
+			e.state = htmlStateTag
+		default:
+			e.attrName.WriteByte(c)
+		}
+	case htmlStateAfterAttrName:
+		switch {
+		case c == '=':
+			e.beginAttrValue()
+		case c == '>':
+			e.endTag()
+		case isHTMLSpace(c):
+		default:
+			e.state = htmlStateAttrName
+			e.attrName.Reset()
+			e.attrName.WriteByte(c)
+		}
+	case htmlStateBeforeAttrValue:
+		switch {
+		case isHTMLSpace(c):
+		case c == '"' || c == '\'':
+			e.state = htmlStateAttrValue
+			e.attrQuote = c
+		case c == '>':
+			e.endTag()
+		default:
+			e.state = htmlStateAttrValue
+			e.attrQuote = 0
+			e.attrValue = append(e.attrValue, c)
+		}
+	case htmlStateAttrValue:
+		switch {
+		case e.attrQuote != 0 && c == e.attrQuote:
+			e.state = htmlStateTag
+		case e.attrQuote == 0 && isHTMLSpace(c):
+			e.state = htmlStateTag
+		case e.attrQuote == 0 && c == '>':
+			e.endTag()
+		default:
+			e.attrValue = append(e.attrValue, c)
+			if e.attrType == htmlAttrJS {
+				e.nextJS(c)
+			}
+		}
+	case htmlStateComment:
+		e.comment = append(e.comment, c)
+		if bytes.HasSuffix(e.comment, []byte("-->")) {
+			e.state = htmlStateText
+			e.comment = e.comment[:0]
+		}
+	case htmlStateRawText:
+		e.rawText = append(e.rawText, c)
+		end := "</" + e.rawTextTag
+		if len(e.rawText) >= len(end) && strings.EqualFold(string(e.rawText[len(e.rawText)-len(end):]), end) {
+			e.state = htmlStateTag
+			e.closingTag = true
+			e.tag.Reset()
+			e.tag.WriteString(e.rawTextTag)
+			e.rawText = e.rawText[:0]
+			e.rawTextTag = ""
+			e.resetJS()
+			return
+		}
+		if e.rawTextTag == "script" {
+			e.nextJS(c)
+		}
+	}
+}
+
+// nextJS keeps track of js string literals, template literals and comments.
+func (e *HTMLEscaper) nextJS(c byte) {
+	prev := e.jsPrev
+	e.jsPrev = c
+	switch {
+	case e.jsComment == '/':
+		if c == '\n' || c == '\r' {
+			e.jsComment = 0
+		}
+	case e.jsComment == '*':
+		if prev == '*' && c == '/' {
+			e.jsComment = 0
+			e.jsPrev = 0
+		}
+	case e.jsEscaped:
+		e.jsEscaped = false
+		e.jsPrev = 0
+	case e.jsQuote != 0 && c == '\\':
+		e.jsEscaped = true
+	case e.jsQuote == '`' && prev == '$' && c == '{':
+		// the substitution of a template literal is js code
+		e.jsTemplates = append(e.jsTemplates, e.jsBraces)
+		e.jsBraces = 0
+		e.jsQuote = 0
+	case e.jsQuote != 0:
+		if c == e.jsQuote {
+			e.jsQuote = 0
+		}
+	case c == '"' || c == '\'' || c == '`':
+		e.jsQuote = c
+	case prev == '/' && (c == '/' || c == '*'):
+		e.jsComment = c
+		e.jsPrev = 0
+	case c == '{':
+		e.jsBraces++
+	case c == '}' && e.jsBraces == 0 && len(e.jsTemplates) > 0:
+		// end of a template literal substitution
+		e.jsBraces = e.jsTemplates[len(e.jsTemplates)-1]
+		e.jsTemplates = e.jsTemplates[:len(e.jsTemplates)-1]
+		e.jsQuote = '`'
+	case c == '}' && e.jsBraces > 0:
+		e.jsBraces--
+	}
+}
+
+// resetJS resets the js state, when a script element or an event handler attribute starts.
+func (e *HTMLEscaper) resetJS() {
+	e.jsQuote = 0
+	e.jsEscaped = false
+	e.jsComment = 0
+	e.jsPrev = 0
+	e.jsTemplates = e.jsTemplates[:0]
+	e.jsBraces = 0
+}
+
+func (e *HTMLEscaper) beginAttrValue() {
+	e.state = htmlStateBeforeAttrValue
+	e.attrValue = e.attrValue[:0]
+	e.resetJS()
+	name := strings.ToLower(e.attrName.String())
+	if i := strings.IndexRune(name, ':'); i >= 0 {
+		// xlink:href => href
+		name = name[i+1:]
+	}
+	switch {
+	case strings.HasPrefix(name, "on"):
+		e.attrType = htmlAttrJS
+	case name == "style":
+		e.attrType = htmlAttrCSS
+	case isURLAttr(name):
+		e.attrType = htmlAttrURL
+	default:
+		e.attrType = htmlAttrNormal
+	}
+}
+
+func (e *HTMLEscaper) endTag() {
+	tag := strings.ToLower(e.tag.String())
+	e.state = htmlStateText
+	if e.closingTag {
+		return
+	}
+	switch tag {
+	case "script", "style", "textarea", "title":
+		e.state = htmlStateRawText
+		e.rawTextTag = tag
+		e.rawText = e.rawText[:0]
+		e.resetJS()
+	}
+}
+
+func isURLAttr(name string) bool {
+	switch name {
+	case "action", "archive", "background", "cite", "classid", "codebase", "data", "formaction", "href", "icon",
+		"longdesc", "manifest", "poster", "profile", "src", "srcset", "usemap":
+		return true
+	}
+	return strings.Contains(name, "url") || strings.Contains(name, "uri")
+}
+
+func isSafeAttrName(s string) bool {
+	if s == "" {
+		return false
+	}
+	lower := strings.ToLower(s)
+	if strings.HasPrefix(lower, "on") || lower == "style" || isURLAttr(lower) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isASCIILetter(c) && !isASCIIDigit(c) && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isASCIIDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+var htmlReplacer = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&#34;",
+	"'", "&#39;",
+	"\x00", "\uFFFD",
+)
+
+func htmlEscape(s string) string {
+	return htmlReplacer.Replace(s)
+}
+
+// htmlEscapeUnquoted escapes s for an unquoted attribute value.
+func htmlEscapeUnquoted(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case '&', '<', '>', '"', '\'', '=', '`', ' ', '\t', '\n', '\r', '\f':
+			fmt.Fprintf(&sb, "&#%d;", r)
+		case 0:
+			sb.WriteRune(utf8.RuneError)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// urlNormalize escapes all characters that are not allowed in an url.
+func urlNormalize(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x80 && (isASCIILetter(c) || isASCIIDigit(c) || strings.IndexByte("-._~:/?#[]@!$&'()*+,;=%", c) >= 0) {
+			if c == '\'' || c == '(' || c == ')' {
+				fmt.Fprintf(&sb, "%%%02X", c)
+				continue
+			}
+			sb.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", c)
+	}
+	return sb.String()
+}
+
+// jsStringEscape escapes s so it can be used inside of a js string literal or template literal.
+func jsStringEscape(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '"' || r == '\'' || r == '`' || r == '<' || r == '>' || r == '&' || r == '=' || r == '/' ||
+			r == '$' || r == '{' || r == '}':
+			fmt.Fprintf(&sb, `\x%02x`, r)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r < ' ':
+			fmt.Fprintf(&sb, `\u%04x`, r)
+		case r == '\u2028' || r == '\u2029':
+			fmt.Fprintf(&sb, `\u%04x`, r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// jsCommentEscape escapes s so it can be used inside of a js comment: it can neither end a block comment (*/) nor a
+// line comment (line terminators).
+func jsCommentEscape(s string) string {
+	return strings.ReplaceAll(jsStringEscape(s), "*", `\x2a`)
+}
+
+// jsEscapeJSON makes sure the json value can be safely embedded into a script element or an attribute.
+// json.Marshal already escapes <, >, &, U+2028 and U+2029.
+func jsEscapeJSON(s string) string {
+	return strings.ReplaceAll(s, "'", `\u0027`)
+}
+
+// cssEscape escapes all characters that could break out of a css value.
+func cssEscape(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if r < utf8.RuneSelf && !isASCIILetter(byte(r)) && !isASCIIDigit(byte(r)) &&
+			r != ' ' && r != '#' && r != '%' && r != '.' && r != ',' && r != '-' && r != '_' {
+			fmt.Fprintf(&sb, `\%x `, r)
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
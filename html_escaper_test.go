@@ -0,0 +1,157 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+func TestHTMLEscaper(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Template string
+		Expect   string
+	}{
+		{
+			"Body",
+			`<p><$ print(context) $></p>`,
+			`<p>&lt;script&gt;alert(&#39;x&#39;)&lt;/script&gt; &amp; &#34;y&#34;</p>`,
+		},
+		{
+			"Expression",
+			`<p><$= context $></p>`,
+			`<p>&lt;script&gt;alert(&#39;x&#39;)&lt;/script&gt; &amp; &#34;y&#34;</p>`,
+		},
+		{
+			"SafeHTML",
+			`<p><$= SafeHTML("<b>bold</b>") $></p>`,
+			`<p><b>bold</b></p>`,
+		},
+		{
+			"SafeHTML in attribute",
+			`<p title="<$= SafeHTML("<b>") $>"></p>`,
+			`<p title="&lt;b&gt;"></p>`,
+		},
+		{
+			"Quoted attribute",
+			`<input value="<$= context $>">`,
+			`<input value="&lt;script&gt;alert(&#39;x&#39;)&lt;/script&gt; &amp; &#34;y&#34;">`,
+		},
+		{
+			"Unquoted attribute",
+			`<input value=<$= "a b" $>>`,
+			`<input value=a&#32;b>`,
+		},
+		{
+			"URL",
+			`<a href="<$= "javascript:alert(1)" $>">x</a>`,
+			`<a href="#ZgotmplZ">x</a>`,
+		},
+		{
+			"URL with safe scheme",
+			`<a href="<$= "https://example.com/a b" $>">x</a>`,
+			`<a href="https://example.com/a%20b">x</a>`,
+		},
+		{
+			"URL query",
+			`<a href="/search?q=<$= "a&b c" $>">x</a>`,
+			`<a href="/search?q=a%26b+c">x</a>`,
+		},
+		{
+			"Script",
+			`<script>var x = <$= context $>;</script>`,
+			`<script>var x = "\u003cscript\u003ealert(\u0027x\u0027)\u003c/script\u003e \u0026 \"y\"";</script>`,
+		},
+		{
+			"Script string",
+			`<script>var x = "<$= "a\"b</script>" $>";</script>`,
+			`<script>var x = "a\x22b\x3c\x2fscript\x3e";</script>`,
+		},
+		{
+			"Script number",
+			`<script>var x = <$= 42 $>;</script>`,
+			`<script>var x = 42;</script>`,
+		},
+		{
+			"Script template literal",
+			"<script>var x = `<$= \"${alert(1)}`\" $>`;</script>",
+			"<script>var x = `\\x24\\x7balert(1)\\x7d\\x60`;</script>",
+		},
+		{
+			"Script template literal substitution",
+			"<script>var x = `a${<$= \"b\" $>}<$= \"c\" $>`;</script>",
+			"<script>var x = `a${\"b\"}c`;</script>",
+		},
+		{
+			"Script block comment",
+			`<script>/* <$= "*/alert(1)/*" $> */</script>`,
+			`<script>/* \x2a\x2falert(1)\x2f\x2a */</script>`,
+		},
+		{
+			"Script line comment",
+			"<script>// <$= \"\\nalert(1)\" $>\nvar x = <$= \"a\" $>;</script>",
+			"<script>// \\nalert(1)\nvar x = \"a\";</script>",
+		},
+		{
+			"Script after comment",
+			`<script>/* it's */ var x = <$= "a" $>; // it's
+var y = 1/<$= 2 $>/2;</script>`,
+			`<script>/* it's */ var x = "a"; // it's
+var y = 1/2/2;</script>`,
+		},
+		{
+			"Event handler",
+			`<button onclick="alert(<$= "it's" $>)">x</button>`,
+			`<button onclick="alert(&#34;it\u0027s&#34;)">x</button>`,
+		},
+		{
+			"Style",
+			`<style>p { color: <$= "red;}" $> }</style>`,
+			`<style>p { color: red\3b \7d  }</style>`,
+		},
+		{
+			"After script",
+			`<script>var a = 1;</script><p><$= "<b>" $></p>`,
+			`<script>var a = 1;</script><p>&lt;b&gt;</p>`,
+		},
+		{
+			"Comment",
+			`<!-- <$= "-->" $> --><p><$= "<b>" $></p>`,
+			`<!-- --&gt; --><p>&lt;b&gt;</p>`,
+		},
+		{
+			"Attribute name",
+			`<p <$= "onclick" $>="x"></p>`,
+			`<p ZgotmplZ="x"></p>`,
+		},
+		{
+			"Implicit return",
+			`context`,
+			`&lt;script&gt;alert(&#39;x&#39;)&lt;/script&gt; &amp; &#34;y&#34;`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			template := MustNew(interp.Options{}, stdlib.Symbols)
+			template.Escaper = NewHTMLEscaper()
+			if test.Name == "Implicit return" {
+				template.StartTokens = nil
+				template.EndTokens = nil
+			}
+			template.MustParseString(test.Template)
+
+			var buf bytes.Buffer
+			template.MustExec(&buf, `<script>alert('x')</script> & "y"`)
+			require.Equal(t, test.Expect, buf.String())
+
+			// the escaper must be reset between executions
+			buf.Reset()
+			template.MustExec(&buf, `<script>alert('x')</script> & "y"`)
+			require.Equal(t, test.Expect, buf.String())
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Eun/yaegi-template/codebuffer"
+)
+
+// ImportOrigin describes where an import was found.
+type ImportOrigin int
+
+const (
+	// ImportFromTemplate is an import in a code block of the template.
+	ImportFromTemplate ImportOrigin = iota
+	// ImportFromPrelude is an import in the prelude, see Prelude().
+	ImportFromPrelude
+	// ImportFromCall is an import that was added with Import() after the template was parsed.
+	ImportFromCall
+	// ImportFromParse is an import that was added with Import() before the template was parsed,
+	// it gets evaluated during LazyParse().
+	ImportFromParse
+)
+
+var importOriginNames = []string{"template", "prelude", "call", "parse"}
+
+func (o ImportOrigin) String() string {
+	if o < 0 || int(o) >= len(importOriginNames) {
+		return "ImportOrigin(" + strconv.Itoa(int(o)) + ")"
+	}
+	return importOriginNames[o]
+}
+
+// MarshalText implements encoding.TextMarshaler, so the origin appears as a name in the audit log.
+func (o ImportOrigin) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// ImportRequest describes an import that is about to be evaluated.
+type ImportRequest struct {
+	// Template is the Name of the template.
+	Template string       `json:"template"`
+	Name     string       `json:"name,omitempty"`
+	Path     string       `json:"path"`
+	Origin   ImportOrigin `json:"origin"`
+	// Line and Column are the position of the import in the template, they are 0 if the import is not part of
+	// the template.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// ImportHook is called for every import of a template (see Template.ImportHook).
+// It returns the path that should be imported, so it can approve (by returning the requested path), rewrite or deny
+// (by returning an error) the import.
+type ImportHook func(ImportRequest) (string, error)
+
+// ImportAuditEntry is an entry of the import audit log (see Template.ImportAudit).
+type ImportAuditEntry struct {
+	Time time.Time `json:"time"`
+	ImportRequest
+	// ImportedPath is the path that was imported, it differs from Path if the import hook rewrote the import.
+	ImportedPath string `json:"imported_path,omitempty"`
+	Denied       bool   `json:"denied,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// JSONAuditLog returns an import audit log that writes every entry as a line of JSON to w.
+//    template.ImportAudit = yaegi_template.JSONAuditLog(os.Stderr)
+func JSONAuditLog(w io.Writer) func(ImportAuditEntry) {
+	var mu sync.Mutex
+	return func(entry ImportAuditEntry) {
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = w.Write(append(b, '\n'))
+	}
+}
+
+// checkImports passes the imports to the import hook and the audit log, it returns the imports that should be
+// evaluated. position returns the position of an import in the template, it can be nil.
+func (t *Template) checkImports(
+	imports importSymbols, origin ImportOrigin, position func(Import) (int, int)) (importSymbols, error) {
+	if t.ImportHook == nil && t.ImportAudit == nil {
+		return imports, nil
+	}
+	result := make(importSymbols, 0, len(imports))
+	for _, imp := range imports {
+		req := ImportRequest{
+			Template: t.Name,
+			Name:     imp.Name,
+			Path:     imp.Path,
+			Origin:   origin,
+		}
+		if position != nil {
+			req.Line, req.Column = position(imp)
+		}
+
+		importPath := imp.Path
+		var err error
+		if t.ImportHook != nil {
+			importPath, err = t.ImportHook(req)
+			if err == nil && importPath == "" {
+				err = errors.New("import hook returned an empty path")
+			}
+		}
+
+		if t.ImportAudit != nil {
+			entry := ImportAuditEntry{
+				Time:          time.Now(),
+				ImportRequest: req,
+				ImportedPath:  importPath,
+			}
+			if err != nil {
+				entry.ImportedPath = ""
+				entry.Denied = true
+				entry.Reason = err.Error()
+			}
+			t.ImportAudit(entry)
+		}
+
+		if err != nil {
+			if req.Line > 0 {
+				return nil, errors.Wrapf(err, "import %q at %d:%d was denied", imp.Path, req.Line, req.Column)
+			}
+			return nil, errors.Wrapf(err, "import %q was denied", imp.Path)
+		}
+		name := imp.Name
+		if name == "" && path.Base(importPath) != path.Base(imp.Path) {
+			// the code still uses the name of the requested package
+			name = path.Base(imp.Path)
+		}
+		result = append(result, Import{Name: name, Path: importPath})
+	}
+	return result, nil
+}
+
+// importPosition returns a function that finds the position of an import in the code parts of the template.
+func importPosition(sources []codebuffer.Part) func(Import) (int, int) {
+	return func(imp Import) (int, int) {
+		for _, quote := range []string{`"`, "`"} {
+			literal := []byte(quote + imp.Path + quote)
+			for _, part := range sources {
+				if part.Type != codebuffer.CodePartType {
+					continue
+				}
+				if i := bytes.Index(part.Content, literal); i >= 0 {
+					return advancePosition(part.Line, part.Column, part.Content[:i])
+				}
+			}
+		}
+		return 0, 0
+	}
+}
@@ -0,0 +1,107 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+func TestImportHook(t *testing.T) {
+	var requests []ImportRequest
+	var entries []ImportAuditEntry
+	newTemplate := func() *Template {
+		requests = nil
+		entries = nil
+		template := MustNew(interp.Options{}, stdlib.Symbols)
+		template.Name = "page.html"
+		template.ImportHook = func(req ImportRequest) (string, error) {
+			requests = append(requests, req)
+			switch req.Path {
+			case "os":
+				return "", errors.New("os is not allowed")
+			case "acme/strings", "acme/text":
+				return "strings", nil
+			}
+			return req.Path, nil
+		}
+		template.ImportAudit = func(entry ImportAuditEntry) {
+			entries = append(entries, entry)
+		}
+		return template
+	}
+
+	t.Run("template", func(t *testing.T) {
+		template := newTemplate().MustParseString("<$\n  import \"acme/strings\" $>Hello <$= strings.ToUpper(\"joe\") $>")
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		require.Equal(t, "Hello JOE", buf.String())
+		require.Equal(t, []ImportRequest{
+			{Template: "page.html", Path: "acme/strings", Origin: ImportFromTemplate, Line: 2, Column: 10},
+		}, requests)
+		require.Len(t, entries, 1)
+		require.Equal(t, "strings", entries[0].ImportedPath)
+		require.False(t, entries[0].Denied)
+	})
+
+	t.Run("different name", func(t *testing.T) {
+		// the code uses the name of the requested package
+		template := newTemplate().MustParseString(`<$ import "acme/text" $>Hello <$= text.ToUpper("joe") $>`)
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		require.Equal(t, "Hello JOE", buf.String())
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		template := newTemplate().MustParseString("<$\nimport \"os\"\n$><$= os.Getpid() $>")
+		_, err := template.Exec(&bytes.Buffer{}, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `import "os" at 2:8 was denied: os is not allowed`)
+		require.Len(t, entries, 1)
+		require.True(t, entries[0].Denied)
+		require.Equal(t, "os is not allowed", entries[0].Reason)
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		template := newTemplate().MustImport(Import{Name: "s", Path: "acme/strings"})
+		require.Empty(t, requests)
+		template.MustParseString(`<$= s.ToUpper("joe") $>`)
+		require.NoError(t, template.Import(Import{Path: "fmt"}))
+		require.EqualError(t, template.Import(Import{Path: "os"}), `import "os" was denied: os is not allowed`)
+		require.Equal(t, []ImportRequest{
+			{Template: "page.html", Name: "s", Path: "acme/strings", Origin: ImportFromParse},
+			{Template: "page.html", Path: "fmt", Origin: ImportFromCall},
+			{Template: "page.html", Path: "os", Origin: ImportFromCall},
+		}, requests)
+	})
+
+	t.Run("prelude", func(t *testing.T) {
+		newTemplate().
+			MustPrelude(`import "fmt"` + "\n" + `func Greet() string { return fmt.Sprint("Hello") }`).
+			MustParseString(`<$= Greet() $>`)
+		require.Equal(t, []ImportRequest{{Template: "page.html", Path: "fmt", Origin: ImportFromPrelude}}, requests)
+	})
+}
+
+func TestJSONAuditLog(t *testing.T) {
+	var buf bytes.Buffer
+	template := MustNew(interp.Options{}, stdlib.Symbols)
+	template.Name = "mail.txt"
+	template.ImportAudit = JSONAuditLog(&buf)
+	template.MustParseString(`<$ import "strings" $><$= strings.ToUpper("a") $>`).MustExec(&bytes.Buffer{}, nil)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1)
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	require.Equal(t, "mail.txt", entry["template"])
+	require.Equal(t, "strings", entry["path"])
+	require.Equal(t, "template", entry["origin"])
+	require.Equal(t, "strings", entry["imported_path"])
+	require.Contains(t, entry, "time")
+}
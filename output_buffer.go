@@ -2,42 +2,302 @@ package yaegi_template
 
 import (
 	"bytes"
+	"reflect"
+
+	"github.com/pkg/errors"
 
 	"go.uber.org/atomic"
 )
 
 type outputBuffer struct {
+	// buf is the buffer that is currently written to, either main or the buffer of a section.
 	buf           *bytes.Buffer
+	main          *bytes.Buffer
 	discardWrites *atomic.Bool
 	size          uint64
+	escaper       Escaper
+	formatters    *formatters
+	// indent is the indentation for the lines written by code blocks, see Template.AutoIndent.
+	indent string
+	// newline is true if the last byte that was written is a newline.
+	newline bool
+	// segments maps the output to the parts of the template, it is only filled if trackSegments is true.
+	segments      []outputSegment
+	trackSegments bool
+	// files holds the offsets at which the output switched to another file, see ExecFiles().
+	files      []outputFile
+	allowFiles bool
+	// captures holds the state of the buffer at the beginning of every active capture, see capture().
+	captures []outputCapture
+	// sections holds the output of the named sections, section is the name of the section that is written to.
+	sections map[string]*bytes.Buffer
+	section  string
+}
+
+// outputCapture is the state of the output buffer at the beginning of a capture.
+type outputCapture struct {
+	buf      *bytes.Buffer
+	section  string
+	offset   int
+	size     uint64
+	newline  bool
+	segments int
+}
+
+// outputFile marks the beginning of a file in the output.
+type outputFile struct {
+	offset int
+	name   string
+}
+
+// outputSegment is a segment of the output, that was written by a text part or by code.
+type outputSegment struct {
+	// offset is the offset of the segment in the output.
+	offset int
+	// part is the index of the text part that wrote the segment, for code segments it is the index of the text part
+	// that was written before (-1 if no text part was written before).
+	part int
+	code bool
 }
 
 func newOutputBuffer(discardWrites bool) *outputBuffer {
+	buf := bytes.NewBuffer(nil)
 	return &outputBuffer{
-		buf:           bytes.NewBuffer(nil),
+		buf:           buf,
+		main:          buf,
 		discardWrites: atomic.NewBool(discardWrites),
 		size:          0,
 	}
 }
 
+// Write writes the output of the code blocks, if an escaper is set the output gets escaped.
 func (ob *outputBuffer) Write(p []byte) (int, error) {
 	if ob.discardWrites.Load() {
 		return len(p), nil
 	}
+	b := p
+	if ob.escaper != nil {
+		b = ob.escaper.Escape(p)
+	}
+	if _, err := ob.writeCode(b); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteText writes a literal text part of the template, it will not be escaped.
+// part is the index of the text part in the program.
+func (ob *outputBuffer) WriteText(part int, p []byte) (int, error) {
+	if ob.discardWrites.Load() {
+		return len(p), nil
+	}
+	if ob.trackSegments && ob.section == "" {
+		ob.segments = append(ob.segments, outputSegment{offset: ob.buf.Len(), part: part})
+	}
+	if ob.escaper != nil {
+		ob.escaper.Text(p)
+	}
+	return ob.write(p)
+}
+
+// WriteValue writes the value of an expression block or an implicit return.
+func (ob *outputBuffer) WriteValue(v reflect.Value) (int, error) {
+	if ob.discardWrites.Load() {
+		return 0, nil
+	}
+	if v.IsValid() && v.CanInterface() {
+		if r, ok := v.Interface().(rawValue); ok {
+			// raw values are written like literal text
+			ob.addCodeSegment()
+			if ob.escaper != nil {
+				ob.escaper.Text([]byte(ob.formatters.format(reflect.ValueOf(r.v))))
+			}
+			return ob.write([]byte(ob.formatters.format(reflect.ValueOf(r.v))))
+		}
+	}
+	s := ob.formatters.format(v)
+	if e, ok := ob.escaper.(valueEscaper); ok {
+		return ob.writeCode(e.escapeValue(v, s))
+	}
+	return ob.Write([]byte(s))
+}
+
+// WriteResult writes the result of the code (implicit return) like WriteValue, pointers without a formatter are not
+// written (see formatters.hidesResult).
+func (ob *outputBuffer) WriteResult(v reflect.Value) (int, error) {
+	if ob.formatters.hidesResult(v) {
+		return 0, nil
+	}
+	return ob.WriteValue(v)
+}
+
+// writeCode writes the output of a code block, the lines are prefixed with the indentation (except the first one).
+func (ob *outputBuffer) writeCode(p []byte) (int, error) {
+	ob.addCodeSegment()
+	if ob.indent == "" {
+		return ob.write(p)
+	}
+	var buf bytes.Buffer
+	newline := ob.newline
+	for _, c := range p {
+		if newline && c != '\n' && c != '\r' {
+			buf.WriteString(ob.indent)
+		}
+		buf.WriteByte(c)
+		newline = c == '\n' || (newline && c == '\r')
+	}
+	return ob.write(buf.Bytes())
+}
+
+// addCodeSegment starts a new code segment, if the last segment was written by a text part.
+func (ob *outputBuffer) addCodeSegment() {
+	if !ob.trackSegments || ob.section != "" {
+		return
+	}
+	part := -1
+	if n := len(ob.segments); n > 0 {
+		if ob.segments[n-1].code {
+			return
+		}
+		part = ob.segments[n-1].part
+	}
+	ob.segments = append(ob.segments, outputSegment{offset: ob.buf.Len(), part: part, code: true})
+}
+
+// SetIndent sets the indentation for the lines written by code blocks.
+func (ob *outputBuffer) SetIndent(indent string) {
+	ob.indent = indent
+}
+
+func (ob *outputBuffer) write(p []byte) (int, error) {
 	n, err := ob.buf.Write(p)
 	if n > 0 {
 		ob.size += uint64(n)
+		ob.newline = p[n-1] == '\n'
 	}
 	return n, err
 }
 
 func (ob *outputBuffer) Reset() {
+	ob.buf = ob.main
 	ob.buf.Reset()
+	ob.sections = nil
+	ob.section = ""
 	ob.size = 0
+	ob.newline = false
+	ob.segments = ob.segments[:0]
+	ob.files = ob.files[:0]
+	ob.captures = ob.captures[:0]
+}
+
+// StartCapture starts capturing the output, until EndCapture gets called.
+// The captured output is escaped like the regular output, so it can be written with raw().
+func (ob *outputBuffer) StartCapture() {
+	ob.captures = append(ob.captures, outputCapture{
+		buf:      ob.buf,
+		section:  ob.section,
+		offset:   ob.buf.Len(),
+		size:     ob.size,
+		newline:  ob.newline,
+		segments: len(ob.segments),
+	})
+	ob.newline = false
+}
+
+// EndCapture ends the last capture, it returns the captured output and removes it from the buffer.
+func (ob *outputBuffer) EndCapture() string {
+	n := len(ob.captures) - 1
+	if n < 0 {
+		return ""
+	}
+	c := ob.captures[n]
+	ob.captures = ob.captures[:n]
+	// the section might have been switched during the capture
+	ob.buf = c.buf
+	ob.section = c.section
+	s := string(ob.buf.Bytes()[c.offset:])
+	ob.buf.Truncate(c.offset)
+	ob.size = c.size
+	ob.newline = c.newline
+	if c.buf == ob.main {
+		ob.segments = ob.segments[:c.segments]
+	}
+	return s
+}
+
+// SetFile switches the output to the file with the specified name, the escaper starts in its initial context.
+func (ob *outputBuffer) SetFile(name string) error {
+	if ob.discardWrites.Load() {
+		return nil
+	}
+	if !ob.allowFiles {
+		return errors.New("file() can only be used with ExecFiles() or ExecFilesTo()")
+	}
+	if len(ob.captures) > 0 {
+		return errors.New("file() can not be used inside of a capture")
+	}
+	if err := validateFileName(name); err != nil {
+		return err
+	}
+	// files are always written to the main output
+	ob.buf = ob.main
+	ob.section = ""
+	ob.files = append(ob.files, outputFile{offset: ob.buf.Len(), name: name})
+	ob.newline = false
+	if ob.escaper != nil {
+		ob.escaper.Reset()
+	}
+	return nil
+}
+
+// SetSection switches the output to the section with the specified name,
+// an empty name switches back to the main output. The escaper starts in its initial context.
+func (ob *outputBuffer) SetSection(name string) error {
+	if ob.discardWrites.Load() {
+		return nil
+	}
+	if name == ob.section {
+		return nil
+	}
+	ob.section = name
+	ob.newline = false
+	if ob.escaper != nil {
+		ob.escaper.Reset()
+	}
+	if name == "" {
+		ob.buf = ob.main
+		return nil
+	}
+	if ob.sections == nil {
+		ob.sections = make(map[string]*bytes.Buffer)
+	}
+	if ob.sections[name] == nil {
+		ob.sections[name] = bytes.NewBuffer(nil)
+	}
+	ob.buf = ob.sections[name]
+	return nil
 }
 
+// Section returns the output that was written to the section with the specified name.
+func (ob *outputBuffer) Section(name string) string {
+	if b, ok := ob.sections[name]; ok {
+		return b.String()
+	}
+	return ""
+}
+
+// Sections returns a copy of the output of all sections.
+func (ob *outputBuffer) Sections() map[string][]byte {
+	sections := make(map[string][]byte, len(ob.sections))
+	for name, b := range ob.sections {
+		sections[name] = append([]byte(nil), b.Bytes()...)
+	}
+	return sections
+}
+
+// Bytes returns the main output.
 func (ob *outputBuffer) Bytes() []byte {
-	return ob.buf.Bytes()
+	return ob.main.Bytes()
 }
 
 func (ob *outputBuffer) DiscardWrites(v bool) {
@@ -47,3 +307,11 @@ func (ob *outputBuffer) DiscardWrites(v bool) {
 func (ob *outputBuffer) Length() uint64 {
 	return ob.size
 }
+
+// SetEscaper sets the escaper that is used for the output of the code blocks and resets it.
+func (ob *outputBuffer) SetEscaper(e Escaper) {
+	ob.escaper = e
+	if e != nil {
+		e.Reset()
+	}
+}
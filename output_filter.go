@@ -0,0 +1,296 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// OutputFilter adds a filter to the output chain, the filters are applied to the rendered output
+// before it gets written to the writer of Exec(). The filters are applied in the order they were added.
+// If a writer that was returned by a filter implements io.Closer, it gets closed after the output was written,
+// so it can flush buffered data.
+//    template.OutputFilter(yaegi_template.MinifyHTML).OutputFilter(yaegi_template.Gzip)
+func (t *Template) OutputFilter(filter func(io.Writer) io.Writer) *Template {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.outputFilters = append(t.outputFilters, filter)
+	return t
+}
+
+// writeOutput writes p through the output filters to out.
+func (t *Template) writeOutput(out io.Writer, p []byte) (int, error) {
+	if len(t.outputFilters) == 0 {
+		return out.Write(p)
+	}
+
+	counter := &countingWriter{w: out}
+	var closers []io.Closer
+	var w io.Writer = counter
+	for i := len(t.outputFilters) - 1; i >= 0; i-- {
+		fw := t.outputFilters[i](w)
+		if c, ok := fw.(io.Closer); ok && !sameWriter(fw, w) {
+			closers = append(closers, c)
+		}
+		w = fw
+	}
+
+	_, err := w.Write(p)
+	// close the writers in the order of the chain, so every writer flushes into the next one
+	for i := len(closers) - 1; i >= 0; i-- {
+		if cerr := closers[i].Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return counter.n, err
+}
+
+// sameWriter returns true if a and b are the same writer, e.g. because a filter returned the writer it got.
+// Writers of types that are not comparable (e.g. structs with a slice field) would panic with ==, they are compared
+// by their content.
+func sameWriter(a, b io.Writer) bool {
+	typ := reflect.TypeOf(a)
+	if typ != reflect.TypeOf(b) {
+		return false
+	}
+	if !typ.Comparable() {
+		return reflect.DeepEqual(a, b)
+	}
+	return a == b
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+// Gzip is an output filter that compresses the output with gzip.
+func Gzip(w io.Writer) io.Writer {
+	return gzip.NewWriter(w)
+}
+
+// NormalizeNewlines returns an output filter that converts all line endings (\r\n, \r and \n) to newline.
+//    template.OutputFilter(yaegi_template.NormalizeNewlines("\r\n"))
+func NormalizeNewlines(newline string) func(io.Writer) io.Writer {
+	return func(w io.Writer) io.Writer {
+		return &newlineWriter{w: w, newline: []byte(newline)}
+	}
+}
+
+type newlineWriter struct {
+	w       io.Writer
+	newline []byte
+	cr      bool
+}
+
+func (nw *newlineWriter) Write(p []byte) (int, error) {
+	var buf bytes.Buffer
+	for _, c := range p {
+		switch {
+		case c == '\r':
+			buf.Write(nw.newline)
+		case c == '\n' && nw.cr:
+			// second part of \r\n
+		case c == '\n':
+			buf.Write(nw.newline)
+		default:
+			buf.WriteByte(c)
+		}
+		nw.cr = c == '\r'
+	}
+	if _, err := nw.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// TrimTrailingWhitespace is an output filter that removes the spaces and tabs at the end of every line.
+func TrimTrailingWhitespace(w io.Writer) io.Writer {
+	return &trailingWhitespaceWriter{w: w}
+}
+
+type trailingWhitespaceWriter struct {
+	w io.Writer
+	// pending holds whitespace that is only written if it is not at the end of a line.
+	pending []byte
+}
+
+func (tw *trailingWhitespaceWriter) Write(p []byte) (int, error) {
+	var buf bytes.Buffer
+	for _, c := range p {
+		switch c {
+		case ' ', '\t', '\r':
+			tw.pending = append(tw.pending, c)
+		case '\n':
+			if bytes.HasSuffix(tw.pending, []byte{'\r'}) {
+				buf.WriteByte('\r')
+			}
+			tw.pending = tw.pending[:0]
+			buf.WriteByte(c)
+		default:
+			buf.Write(tw.pending)
+			tw.pending = tw.pending[:0]
+			buf.WriteByte(c)
+		}
+	}
+	if _, err := tw.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close drops the whitespace at the end of the output.
+func (tw *trailingWhitespaceWriter) Close() error {
+	tw.pending = tw.pending[:0]
+	return nil
+}
+
+// MinifyHTML is an output filter that removes unnecessary whitespace and comments from html.
+// Runs of whitespace are collapsed into a single space, whitespace between two tags is removed if it contains
+// a newline. The contents of pre, textarea, script and style elements and conditional comments are kept.
+func MinifyHTML(w io.Writer) io.Writer {
+	return &htmlMinifier{w: w}
+}
+
+type minifyState uint8
+
+const (
+	minifyText minifyState = iota
+	minifyTag
+	minifyComment
+	minifyRaw
+	minifyRawClose
+)
+
+type htmlMinifier struct {
+	w     io.Writer
+	state minifyState
+	// whitespace is true if whitespace was skipped, newline is true if it contained a newline.
+	whitespace bool
+	newline    bool
+	// last is the last byte that was written.
+	last byte
+	// tag holds the current tag or comment.
+	tag   []byte
+	quote byte
+	// rawTag is the name of the raw element (pre, textarea, script, style) whose content is written.
+	rawTag string
+	raw    []byte
+}
+
+func (m *htmlMinifier) Write(p []byte) (int, error) {
+	var buf bytes.Buffer
+	for _, c := range p {
+		m.next(&buf, c)
+	}
+	if _, err := m.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (m *htmlMinifier) next(buf *bytes.Buffer, c byte) {
+	switch m.state {
+	case minifyText:
+		switch {
+		case isHTMLSpace(c):
+			m.whitespace = true
+			m.newline = m.newline || c == '\n'
+		case c == '<':
+			m.flushWhitespace(buf, m.last == '>' && m.newline)
+			m.state = minifyTag
+			m.tag = append(m.tag[:0], c)
+			m.quote = 0
+		default:
+			m.flushWhitespace(buf, false)
+			m.write(buf, c)
+		}
+	case minifyTag:
+		m.tag = append(m.tag, c)
+		switch {
+		case string(m.tag) == "<!--":
+			m.state = minifyComment
+		case m.quote != 0:
+			if c == m.quote {
+				m.quote = 0
+			}
+		case c == '"' || c == '\'':
+			m.quote = c
+		case c == '>':
+			buf.Write(m.tag)
+			m.last = c
+			m.state = minifyText
+			if name := tagName(m.tag); name == "pre" || name == "textarea" || name == "script" || name == "style" {
+				m.state = minifyRaw
+				m.rawTag = name
+				m.raw = m.raw[:0]
+			}
+		}
+	case minifyComment:
+		m.tag = append(m.tag, c)
+		if bytes.HasSuffix(m.tag, []byte("-->")) && len(m.tag) >= len("<!---->") {
+			if bytes.HasPrefix(m.tag, []byte("<!--[")) {
+				// keep conditional comments
+				buf.Write(m.tag)
+				m.last = '>'
+			}
+			m.state = minifyText
+		}
+	case minifyRaw:
+		m.write(buf, c)
+		m.raw = append(m.raw, c)
+		end := "</" + m.rawTag
+		if len(m.raw) >= len(end) && strings.EqualFold(string(m.raw[len(m.raw)-len(end):]), end) {
+			m.state = minifyRawClose
+		}
+	case minifyRawClose:
+		m.write(buf, c)
+		if c == '>' {
+			m.state = minifyText
+		}
+	}
+}
+
+func (m *htmlMinifier) write(buf *bytes.Buffer, c byte) {
+	buf.WriteByte(c)
+	m.last = c
+}
+
+// flushWhitespace writes a single space for the skipped whitespace, unless drop is true.
+func (m *htmlMinifier) flushWhitespace(buf *bytes.Buffer, drop bool) {
+	if m.whitespace && !drop && m.last != 0 {
+		m.write(buf, ' ')
+	}
+	m.whitespace = false
+	m.newline = false
+}
+
+// Close writes an unfinished tag, whitespace at the end of the output is dropped.
+func (m *htmlMinifier) Close() error {
+	if m.state != minifyTag && m.state != minifyComment {
+		return nil
+	}
+	m.state = minifyText
+	_, err := m.w.Write(m.tag)
+	return err
+}
+
+// tagName returns the lower case name of an opening tag, an empty string is returned for closing tags.
+func tagName(tag []byte) string {
+	name := bytes.TrimPrefix(tag, []byte("<"))
+	end := bytes.IndexFunc(name, func(r rune) bool {
+		return !isASCIILetter(byte(r)) && !isASCIIDigit(byte(r))
+	})
+	if end >= 0 {
+		name = name[:end]
+	}
+	return strings.ToLower(string(name))
+}
@@ -0,0 +1,152 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+func TestOutputFilter(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Filters  []func(io.Writer) io.Writer
+		Template string
+		Expect   string
+	}{
+		{
+			"MinifyHTML",
+			[]func(io.Writer) io.Writer{MinifyHTML},
+			`<html>
+	<body>
+		<!-- comment -->
+		<p class="a  b">Hello   <$ print("  World  ") $> <b>!</b></p>
+		<pre>
+  keep   this
+</pre>
+		<script>if (a  <  b) {}</script>
+		<!--[if IE]><p>IE</p><![endif]-->
+	</body>
+</html>
+`,
+			`<html><body><p class="a  b">Hello World <b>!</b></p><pre>
+  keep   this
+</pre><script>if (a  <  b) {}</script><!--[if IE]><p>IE</p><![endif]--></body></html>`,
+		},
+		{
+			"NormalizeNewlines CRLF",
+			[]func(io.Writer) io.Writer{NormalizeNewlines("\r\n")},
+			"a\nb\r\nc\rd<$ print(\"\\n\") $>",
+			"a\r\nb\r\nc\r\nd\r\n",
+		},
+		{
+			"NormalizeNewlines LF",
+			[]func(io.Writer) io.Writer{NormalizeNewlines("\n")},
+			"a\r\nb\rc",
+			"a\nb\nc",
+		},
+		{
+			"TrimTrailingWhitespace",
+			[]func(io.Writer) io.Writer{TrimTrailingWhitespace},
+			"a  \n\tb\t\r\nc <$ print(\"d  \") $>",
+			"a\n\tb\r\nc d",
+		},
+		{
+			"Chain",
+			[]func(io.Writer) io.Writer{TrimTrailingWhitespace, NormalizeNewlines("\r\n")},
+			"a  \nb  ",
+			"a\r\nb",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			template := MustNew(interp.Options{}, stdlib.Symbols)
+			for _, filter := range test.Filters {
+				template.OutputFilter(filter)
+			}
+			template.MustParseString(test.Template)
+
+			var buf bytes.Buffer
+			n, err := template.Exec(&buf, nil)
+			require.NoError(t, err)
+			require.Equal(t, test.Expect, buf.String())
+			require.Equal(t, buf.Len(), n)
+		})
+	}
+
+	t.Run("Gzip", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			OutputFilter(TrimTrailingWhitespace).
+			OutputFilter(Gzip).
+			MustParseString(`Hello <$ print("World") $>  `)
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		r, err := gzip.NewReader(&buf)
+		require.NoError(t, err)
+		b, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, "Hello World", string(b))
+	})
+
+	t.Run("Custom", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			OutputFilter(func(w io.Writer) io.Writer {
+				return &upperWriter{w: w}
+			}).
+			MustParseString(`Hello <$ print("World") $>`)
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		require.Equal(t, "HELLO WORLD", buf.String())
+	})
+
+	t.Run("Not comparable", func(t *testing.T) {
+		var closed []string
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			OutputFilter(func(w io.Writer) io.Writer {
+				// returns the writer it got
+				return w
+			}).
+			OutputFilter(func(w io.Writer) io.Writer {
+				return sliceWriter{w: w, closed: &closed}
+			}).
+			MustParseString(`Hello <$ print("World") $>`)
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		require.Equal(t, "Hello World", buf.String())
+		require.Equal(t, []string{"closed"}, closed)
+	})
+}
+
+// sliceWriter is not comparable.
+type sliceWriter struct {
+	w      io.Writer
+	closed *[]string
+	_      []byte
+}
+
+func (s sliceWriter) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+func (s sliceWriter) Close() error {
+	*s.closed = append(*s.closed, "closed")
+	return nil
+}
+
+type upperWriter struct {
+	w io.Writer
+}
+
+func (u *upperWriter) Write(p []byte) (int, error) {
+	return u.w.Write([]byte(strings.ToUpper(string(p))))
+}
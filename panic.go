@@ -0,0 +1,412 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/traefik/yaegi/interp"
+)
+
+// PanicError is returned if the code of a template panics.
+//    _, err := template.Exec(w, nil)
+//    var panicErr *yaegi_template.PanicError
+//    if errors.As(err, &panicErr) {
+//        log.Printf("template panicked at %d:%d: %v\n%s", panicErr.Line, panicErr.Column, panicErr.Value, panicErr.Stack)
+//    }
+type PanicError struct {
+	// Value is the value that was passed to panic.
+	Value interface{}
+	// Line and Column are the position in the template where the panic occurred, they are 0 if the position is
+	// unknown. If the panic occurred in a function of the prelude, it is the position of the call in the template.
+	// For panics of goroutines, that were started by the template, it is the position of the go statement.
+	Line   int
+	Column int
+	// Frames holds the positions of the interpreted calls in the template, that led to the panic,
+	// the innermost call first.
+	Frames []PanicFrame
+	// Goroutine is true if the panic occurred in a goroutine that was started by the template.
+	Goroutine bool
+	// Stack is the stack of the interpreter (as returned by debug.Stack) at the time of the panic.
+	Stack []byte
+
+	// positions holds the positions that were reported by the interpreter, they are mapped to the template by
+	// locate.
+	positions []PanicFrame
+}
+
+// PanicFrame is the position of a call in the template.
+type PanicFrame struct {
+	// File is the file name of the prelude (e.g. prelude.go) if the call is part of a prelude,
+	// it is empty for calls in the template.
+	File   string
+	Line   int
+	Column int
+}
+
+func (e *PanicError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprint(e.Value)
+	}
+	if e.Goroutine {
+		return fmt.Sprintf("%v (goroutine started at template %d:%d)", e.Value, e.Line, e.Column)
+	}
+	return fmt.Sprintf("%v (template %d:%d)", e.Value, e.Line, e.Column)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// newPanicError creates a PanicError from the recovered value, positions are the positions that were reported by
+// the interpreter during the panic.
+func newPanicError(recovered interface{}, positions []PanicFrame) *PanicError {
+	err := &PanicError{Value: recovered, positions: positions}
+	if p, ok := recovered.(interp.Panic); ok {
+		err.Value, err.Stack = p.Value, p.Stack
+	} else {
+		err.Stack = debug.Stack()
+	}
+	// the interpreter panics with the reflect.Value of interpreted panic calls
+	if v, ok := err.Value.(reflect.Value); ok && v.IsValid() && v.CanInterface() {
+		err.Value = v.Interface()
+	}
+	return err
+}
+
+// locate maps the positions of the interpreter to the template, code is the code that was evaluated.
+// The code is evaluated after the macros, the macros are evaluated with codeLines empty lines in front of them, so
+// the positions can be told apart.
+func (e *PanicError) locate(prog *program, code string, codeLines int) {
+	macros := prog.macros.Bytes()
+	for _, pos := range e.positions {
+		if pos.File != "" {
+			e.Frames = append(e.Frames, pos)
+			continue
+		}
+		var line, column int
+		if pos.Line == 1 {
+			pos.Column -= wrapColumns(code)
+		}
+		if pos.Line > codeLines {
+			if offset, ok := lineOffset(macros, pos.Line-codeLines, pos.Column); ok {
+				line, column = prog.position(true, offset)
+			}
+		} else if offset, ok := lineOffset([]byte(code), pos.Line, pos.Column); ok {
+			line, column = prog.position(false, offset)
+		}
+		if line == 0 {
+			continue
+		}
+		e.Frames = append(e.Frames, PanicFrame{Line: line, Column: column})
+	}
+	for _, frame := range e.Frames {
+		if frame.File == "" {
+			e.Line, e.Column = frame.Line, frame.Column
+			break
+		}
+	}
+}
+
+// wrapColumns returns the number of columns the interpreter adds in front of the first line of code, when it wraps
+// the code into a file.
+func wrapColumns(code string) int {
+	switch tok := firstToken(code); {
+	case tok == token.PACKAGE:
+		return 0
+	case isDeclToken(tok):
+		return len("package main;")
+	}
+	return len("package main; func main() {")
+}
+
+// firstToken returns the first token of code, comments are skipped.
+func firstToken(code string) token.Token {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", fset.Base(), len(code)), []byte(code), nil, 0)
+	_, tok, _ := s.Scan()
+	return tok
+}
+
+// isDeclToken reports whether tok starts a declaration, the interpreter does not wrap such code into a main function.
+func isDeclToken(tok token.Token) bool {
+	switch tok {
+	case token.CONST, token.FUNC, token.IMPORT, token.TYPE, token.VAR:
+		return true
+	}
+	return false
+}
+
+// lineOffset returns the offset of the 1 based line and column in b.
+func lineOffset(b []byte, line, column int) (int, bool) {
+	offset := 0
+	for i := 1; i < line; i++ {
+		n := bytes.IndexByte(b[offset:], '\n')
+		if n < 0 {
+			return 0, false
+		}
+		offset += n + 1
+	}
+	offset += column - 1
+	if offset < 0 || offset > len(b) {
+		return 0, false
+	}
+	return offset, true
+}
+
+// panicLineRegexp matches the lines the interpreter writes to stderr for every frame of a panic.
+// The positions of the preludes are prefixed with their file name.
+var panicLineRegexp = regexp.MustCompile(`^(?:(.+):)?(\d+):(\d+): panic\n$`)
+
+// panicWriter is the stderr of the interpreter, it collects the positions of panics instead of writing them.
+type panicWriter struct {
+	w io.Writer
+
+	mu        sync.Mutex
+	positions []PanicFrame
+}
+
+func newPanicWriter(w io.Writer) *panicWriter {
+	if w == nil {
+		w = os.Stderr
+	}
+	return &panicWriter{w: w}
+}
+
+func (pw *panicWriter) Write(p []byte) (int, error) {
+	m := panicLineRegexp.FindSubmatch(p)
+	if m == nil {
+		return pw.w.Write(p)
+	}
+	file := string(m[1])
+	if file == "_.go" {
+		file = ""
+	}
+	line, _ := strconv.Atoi(string(m[2]))
+	column, _ := strconv.Atoi(string(m[3]))
+	pw.mu.Lock()
+	pw.positions = append(pw.positions, PanicFrame{File: file, Line: line, Column: column})
+	pw.mu.Unlock()
+	return len(p), nil
+}
+
+// take returns the collected positions and resets them.
+func (pw *panicWriter) take() []PanicFrame {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	positions := pw.positions
+	pw.positions = nil
+	return positions
+}
+
+// goroutines tracks the panics of the goroutines that were started by a template.
+type goroutines struct {
+	stderr io.Writer
+	// handler is the GoroutinePanicHandler of the template.
+	handler func(*PanicError)
+
+	mu      sync.Mutex
+	running bool
+	err     *PanicError
+}
+
+// begin is called before the template gets executed.
+func (g *goroutines) begin(handler func(*PanicError)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.handler = handler
+	g.running = true
+	g.err = nil
+}
+
+// end is called after the template was executed, it returns the first panic of a goroutine during the execution.
+func (g *goroutines) end() *PanicError {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.running = false
+	return g.err
+}
+
+// report reports the panic of a goroutine.
+// During the execution it gets returned by Exec(), afterwards it is passed to the handler or written to stderr.
+func (g *goroutines) report(err *PanicError) {
+	g.mu.Lock()
+	if g.running {
+		if g.err == nil {
+			g.err = err
+		}
+		g.mu.Unlock()
+		return
+	}
+	handler := g.handler
+	g.mu.Unlock()
+	if handler != nil {
+		handler(err)
+		return
+	}
+	_, _ = fmt.Fprintf(g.stderr, "panic in goroutine of template: %s\n%s", err.Error(), err.Stack)
+}
+
+// start calls fn with args in a new goroutine, line and column are the position of the go statement.
+// It replaces the go statements of the template (see rewriteGoStatement), so panics get recovered.
+func (g *goroutines) start(line, column int, fn interface{}, args ...interface{}) {
+	f := reflect.ValueOf(fn)
+	if f.Kind() != reflect.Func {
+		panic(fmt.Sprintf("go statement at %d:%d: %T is not a function", line, column, fn))
+	}
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var typ reflect.Type
+		switch {
+		case f.Type().IsVariadic() && i >= f.Type().NumIn()-1:
+			typ = f.Type().In(f.Type().NumIn() - 1).Elem()
+		case i < f.Type().NumIn():
+			typ = f.Type().In(i)
+		default:
+			panic(fmt.Sprintf("go statement at %d:%d: too many arguments", line, column))
+		}
+		if arg == nil {
+			in[i] = reflect.Zero(typ)
+			continue
+		}
+		v := reflect.ValueOf(arg)
+		if v.Type() != typ && v.Type().ConvertibleTo(typ) && typ.Kind() != reflect.Interface {
+			// untyped constants are passed with their default type
+			v = v.Convert(typ)
+		}
+		in[i] = v
+	}
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err := newPanicError(r, nil)
+				err.Line, err.Column = line, column
+				err.Goroutine = true
+				g.report(err)
+			}
+		}()
+		f.Call(in)
+	}()
+}
+
+// goStatement is a go statement of a code part.
+type goStatement struct {
+	// start is the offset of the go keyword, end the offset after the call.
+	start int
+	end   int
+	call  *ast.CallExpr
+	// expr is the source of the call.
+	expr string
+	// exprStart is the offset of the call.
+	exprStart int
+}
+
+// findGoStatements returns the go statements of code, that are complete.
+// incomplete is the offset of a go statement that continues in another code part, or -1.
+func findGoStatements(code []byte) (statements []goStatement, incomplete int) {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(code))
+	s.Init(file, code, nil, 0)
+
+	for {
+		pos, tok, _ := s.Scan()
+		if tok == token.EOF {
+			return statements, -1
+		}
+		if tok != token.GO {
+			continue
+		}
+		stmt := goStatement{start: file.Offset(pos), exprStart: -1, end: -1}
+		depth := 0
+		eof := false
+		for stmt.end < 0 {
+			pos, tok, _ := s.Scan()
+			if stmt.exprStart < 0 {
+				stmt.exprStart = file.Offset(pos)
+			}
+			switch tok {
+			case token.LPAREN, token.LBRACK, token.LBRACE:
+				depth++
+			case token.RPAREN, token.RBRACK, token.RBRACE:
+				depth--
+				if depth < 0 {
+					stmt.end = file.Offset(pos)
+				}
+			case token.SEMICOLON:
+				if depth == 0 {
+					stmt.end = file.Offset(pos)
+				}
+			case token.EOF:
+				if depth != 0 {
+					// the statement continues in another code part
+					return statements, stmt.start
+				}
+				stmt.end = len(code)
+				eof = true
+			}
+		}
+		if stmt.end > len(code) {
+			stmt.end = len(code)
+		}
+		stmt.expr = string(code[stmt.exprStart:stmt.end])
+		expr, err := parser.ParseExpr(stmt.expr)
+		if err != nil {
+			continue
+		}
+		if call, ok := expr.(*ast.CallExpr); ok {
+			stmt.call = call
+			statements = append(statements, stmt)
+		}
+		if eof {
+			return statements, -1
+		}
+	}
+}
+
+// rewriteGoStatement returns the replacement for a go statement:
+//    go work(i, "a")   =>   __go(line, column, work, i, "a")
+// The function and the arguments are evaluated immediately, like they are by the go statement.
+// rewrite is applied to the function and the arguments, so nested go statements are rewritten too.
+func rewriteGoStatement(stmt goStatement, line, column int, rewrite func(offset int, code string) string) string {
+	src := func(n ast.Node) string {
+		start, end := int(n.Pos())-1, int(n.End())-1
+		return rewrite(stmt.exprStart+start, stmt.expr[start:end])
+	}
+	var sb strings.Builder
+	sb.WriteString("__go(")
+	sb.WriteString(strconv.Itoa(line))
+	sb.WriteString(", ")
+	sb.WriteString(strconv.Itoa(column))
+	sb.WriteString(", ")
+	if stmt.call.Ellipsis.IsValid() {
+		// the arguments can not be passed separately
+		sb.WriteString("func() { ")
+		sb.WriteString(rewrite(stmt.exprStart, stmt.expr))
+		sb.WriteString(" })")
+		return sb.String()
+	}
+	sb.WriteString(src(stmt.call.Fun))
+	for _, arg := range stmt.call.Args {
+		sb.WriteString(", ")
+		sb.WriteString(src(arg))
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
@@ -0,0 +1,157 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+func TestPanicError(t *testing.T) {
+	t.Run("position", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString("Hello\n<$ x := 1 $><$ panic(x) $>")
+		_, err := template.Exec(&bytes.Buffer{}, nil)
+		var panicErr *PanicError
+		require.True(t, errors.As(err, &panicErr))
+		require.Equal(t, 1, panicErr.Value)
+		require.Equal(t, 2, panicErr.Line)
+		require.Equal(t, 16, panicErr.Column)
+		require.False(t, panicErr.Goroutine)
+		require.NotEmpty(t, panicErr.Stack)
+	})
+
+	t.Run("macro", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<$ macro Boom(msg string) $>
+<$ if msg != "" { panic(msg) } $><$ end $>
+Hello
+<$ Boom("") $>
+<$ Boom("fail") $>`)
+		_, err := template.Exec(&bytes.Buffer{}, nil)
+		var panicErr *PanicError
+		require.True(t, errors.As(err, &panicErr))
+		require.Equal(t, "fail", panicErr.Value)
+		require.Equal(t, []PanicFrame{{Line: 2, Column: 19}, {Line: 5, Column: 4}}, panicErr.Frames)
+		require.Equal(t, 2, panicErr.Line)
+		require.Equal(t, 19, panicErr.Column)
+	})
+
+	t.Run("unwrap", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<$ import "io" $><$ panic(io.EOF) $>`)
+		_, err := template.Exec(&bytes.Buffer{}, nil)
+		require.True(t, errors.Is(err, io.EOF))
+	})
+
+	t.Run("stderr", func(t *testing.T) {
+		var stderr bytes.Buffer
+		template := MustNew(interp.Options{Stderr: &stderr}, stdlib.Symbols).
+			MustParseString(`<$ panic("Oh no") $>`)
+		_, err := template.Exec(&bytes.Buffer{}, nil)
+		require.Error(t, err)
+		require.Empty(t, stderr.String())
+	})
+}
+
+func TestGoroutinePanic(t *testing.T) {
+	t.Run("during execution", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<$ import "sync" $><$ wg := &sync.WaitGroup{}
+wg.Add(1)
+go func() {
+	defer wg.Done()
+	panic("in goroutine")
+}()
+wg.Wait() $>`)
+		_, err := template.Exec(&bytes.Buffer{}, nil)
+		var panicErr *PanicError
+		require.True(t, errors.As(err, &panicErr))
+		require.Equal(t, "in goroutine", panicErr.Value)
+		require.True(t, panicErr.Goroutine)
+		require.Equal(t, 3, panicErr.Line)
+		require.Equal(t, 1, panicErr.Column)
+		require.Contains(t, err.Error(), "in goroutine (goroutine started at template 3:1)")
+	})
+
+	t.Run("handler", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<$ import "time" $><$ go func(d time.Duration) {
+	time.Sleep(d)
+	panic("later")
+}(10 * time.Millisecond) $>Done`)
+		var mu sync.Mutex
+		var handled *PanicError
+		template.GoroutinePanicHandler = func(err *PanicError) {
+			mu.Lock()
+			defer mu.Unlock()
+			handled = err
+		}
+		var buf bytes.Buffer
+		_, err := template.Exec(&buf, nil)
+		require.NoError(t, err)
+		require.Equal(t, "Done", buf.String())
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return handled != nil
+		}, time.Second, 5*time.Millisecond)
+		require.Equal(t, "later", handled.Value)
+		require.Equal(t, 1, handled.Line)
+		require.Equal(t, 23, handled.Column)
+	})
+
+	t.Run("arguments are evaluated immediately", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<$ import "sync" $><$ mu := &sync.Mutex{}
+wg := &sync.WaitGroup{}
+sum := 0
+add := func(n int) {
+	defer wg.Done()
+	mu.Lock()
+	sum += n
+	mu.Unlock()
+}
+for i := 1; i <= 4; i++ {
+	wg.Add(1)
+	go add(i)
+}
+wg.Wait() $><$= sum $>`)
+		var buf bytes.Buffer
+		_, err := template.Exec(&buf, nil)
+		require.NoError(t, err)
+		require.Equal(t, "10", buf.String())
+	})
+
+	t.Run("macro", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<$ import "sync" $><$ macro Spawn(wg *sync.WaitGroup) $><$ go func() {
+	defer wg.Done()
+	panic("in macro")
+}() $><$ end $><$ wg := &sync.WaitGroup{}
+wg.Add(1)
+Spawn(wg)
+wg.Wait() $>`)
+		_, err := template.Exec(&bytes.Buffer{}, nil)
+		var panicErr *PanicError
+		require.True(t, errors.As(err, &panicErr))
+		require.True(t, panicErr.Goroutine)
+		require.Equal(t, 1, panicErr.Line)
+		require.Equal(t, 60, panicErr.Column)
+	})
+
+	t.Run("spanning code parts", func(t *testing.T) {
+		// the go statement can not be rewritten, the panic would kill the process
+		err := MustNew(interp.Options{}, stdlib.Symbols).
+			Parse(strings.NewReader(`Hello <$ go func() { $>text<$ panic("boom") }() $>`))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "go statement at 1:10 continues in another code part")
+	})
+}
@@ -0,0 +1,204 @@
+package yaegi_template
+
+import (
+	"path"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+
+	"github.com/Eun/yaegi-template/helpers"
+)
+
+// Policy filters the symbols that are available to templates.
+//
+// A pattern is either an import path, that matches all symbols of the package, or an import path followed by a dot
+// and a symbol name:
+//    fmt            all symbols of fmt
+//    os.Getenv      only Getenv of os
+//    fmt.Print*     Print, Printf and Println of fmt
+//    encoding/...   all packages below encoding (and encoding itself)
+// The elements of the import path and the symbol name can contain the wildcards of path.Match.
+//
+// A symbol is available if it matches a pattern of Allow (or Allow is empty) and does not match a pattern of Deny.
+type Policy struct {
+	Allow []string
+	Deny  []string
+}
+
+// Filter returns the exports that are allowed by the policy.
+func (p *Policy) Filter(exports interp.Exports) interp.Exports {
+	if p == nil {
+		return exports
+	}
+	result := make(interp.Exports, len(exports))
+	for key, symbols := range exports {
+		// the keys have the form import/path/name
+		importPath := path.Dir(key)
+		allowed := make(map[string]reflect.Value)
+		var wrappers []string
+		for name, value := range symbols {
+			if strings.HasPrefix(name, "_") {
+				// wrappers of interfaces, they are needed if any symbol of the package is available
+				wrappers = append(wrappers, name)
+				continue
+			}
+			if p.Allowed(importPath, name) {
+				allowed[name] = value
+			}
+		}
+		if len(allowed) == 0 {
+			continue
+		}
+		for _, name := range wrappers {
+			allowed[name] = symbols[name]
+		}
+		result[key] = allowed
+	}
+	return result
+}
+
+// Allowed returns true if the symbol name of the package with the import path is allowed by the policy.
+func (p *Policy) Allowed(importPath, name string) bool {
+	if p == nil {
+		return true
+	}
+	if p.denied(importPath, name) {
+		return false
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	for _, pattern := range p.Allow {
+		if matchSymbol(pattern, importPath, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// denied returns true if the symbol name of the package with the import path matches a pattern of Deny.
+func (p *Policy) denied(importPath, name string) bool {
+	if p == nil {
+		return false
+	}
+	for _, pattern := range p.Deny {
+		if matchSymbol(pattern, importPath, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSymbol returns true if the pattern matches the symbol name of the package with the import path.
+func matchSymbol(pattern, importPath, name string) bool {
+	pkgPattern, symbolPattern := splitSymbolPattern(pattern)
+	if symbolPattern != "" {
+		if ok, _ := path.Match(symbolPattern, name); !ok {
+			return false
+		}
+	}
+	if strings.HasSuffix(pkgPattern, "/...") {
+		pkgPattern = strings.TrimSuffix(pkgPattern, "/...")
+		prefix := strings.Split(pkgPattern, "/")
+		elems := strings.Split(importPath, "/")
+		if len(elems) < len(prefix) {
+			return false
+		}
+		importPath = strings.Join(elems[:len(prefix)], "/")
+	}
+	ok, _ := path.Match(pkgPattern, importPath)
+	return ok
+}
+
+// splitSymbolPattern splits the pattern into the package and the symbol pattern.
+// Dots in the last element of the import path only separate the symbol, if the symbol starts with an upper case
+// letter or a wildcard, so import paths like gopkg.in/yaml.v3 stay intact.
+func splitSymbolPattern(pattern string) (pkg, symbol string) {
+	i := strings.LastIndexByte(pattern, '.')
+	if i < 0 || i < strings.LastIndexByte(pattern, '/') || i == len(pattern)-1 {
+		return pattern, ""
+	}
+	r := rune(pattern[i+1])
+	if unicode.IsUpper(r) || strings.ContainsRune("*?[", r) {
+		return pattern[:i], pattern[i+1:]
+	}
+	return pattern, ""
+}
+
+// SafePolicy returns the policy that is used by SafeSymbols.
+// It allows packages that can not access the file system, the network, the environment or other processes and
+// denies symbols that read from the standard input or block for a long time.
+// Note that fmt.Print, fmt.Printf and fmt.Println write to the output of the template.
+func SafePolicy() *Policy {
+	return &Policy{
+		Allow: []string{
+			"bufio",
+			"bytes",
+			"container/...",
+			"context",
+			"crypto/hmac",
+			"crypto/md5",
+			"crypto/sha1",
+			"crypto/sha256",
+			"crypto/sha512",
+			"encoding",
+			"encoding/base32",
+			"encoding/base64",
+			"encoding/csv",
+			"encoding/hex",
+			"encoding/json",
+			"encoding/xml",
+			"errors",
+			"fmt",
+			"hash",
+			"hash/adler32",
+			"hash/crc32",
+			"hash/crc64",
+			"hash/fnv",
+			"html",
+			"io",
+			"math",
+			"math/big",
+			"math/bits",
+			"math/cmplx",
+			"math/rand",
+			"net/url",
+			"path",
+			"regexp",
+			"regexp/syntax",
+			"sort",
+			"strconv",
+			"strings",
+			"text/tabwriter",
+			"time",
+			"unicode",
+			"unicode/utf16",
+			"unicode/utf8",
+			helpers.ImportPath,
+		},
+		Deny: []string{
+			// read from the standard input of the process
+			"fmt.Scan*",
+			// block or start timers
+			"time.Sleep",
+			"time.After*",
+			"time.Tick",
+			"time.NewTicker",
+			"time.NewTimer",
+			"context.WithDeadline",
+			"context.WithTimeout",
+		},
+	}
+}
+
+// SafeSymbols returns a reviewed subset of DefaultSymbols, that can be used for templates of untrusted authors.
+// See SafePolicy for the allowed packages:
+//    template := yaegi_template.MustNew(yaegi_template.DefaultOptions(), yaegi_template.SafeSymbols()...)
+//    template.Policy = yaegi_template.SafePolicy()
+// Setting the policy makes sure that symbols, that are added later with Use, are filtered too.
+func SafeSymbols() []interp.Exports {
+	return []interp.Exports{SafePolicy().Filter(stdlib.Symbols), SafePolicy().Filter(helpers.Symbols)}
+}
@@ -0,0 +1,92 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+func TestPolicy_Allowed(t *testing.T) {
+	policy := &Policy{
+		Allow: []string{"fmt", "os.Getenv", "encoding/...", "gopkg.in/yaml.v3", "strings.To*"},
+		Deny:  []string{"fmt.Print*", "encoding/gob"},
+	}
+	tests := []struct {
+		ImportPath string
+		Name       string
+		Allowed    bool
+	}{
+		{"fmt", "Sprintf", true},
+		{"fmt", "Println", false},
+		{"os", "Getenv", true},
+		{"os", "Remove", false},
+		{"encoding", "TextMarshaler", true},
+		{"encoding/json", "Marshal", true},
+		{"encoding/gob", "NewEncoder", false},
+		{"encodingx", "Foo", false},
+		{"gopkg.in/yaml.v3", "Marshal", true},
+		{"strings", "ToUpper", true},
+		{"strings", "Repeat", false},
+		{"net", "Dial", false},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.Allowed, policy.Allowed(test.ImportPath, test.Name), "%s.%s", test.ImportPath, test.Name)
+	}
+
+	var nilPolicy *Policy
+	require.True(t, nilPolicy.Allowed("os", "Remove"))
+}
+
+func TestPolicy_Filter(t *testing.T) {
+	exports := (&Policy{Allow: []string{"io.Copy"}}).Filter(stdlib.Symbols)
+	require.Len(t, exports, 1)
+	require.Contains(t, exports["io/io"], "Copy")
+	require.NotContains(t, exports["io/io"], "ReadAll")
+	// the interface wrappers are kept, so interpreted types can implement the interfaces
+	require.Contains(t, exports["io/io"], "_Reader")
+}
+
+func TestSafeSymbols(t *testing.T) {
+	newTemplate := func() *Template {
+		template := MustNew(interp.Options{}, SafeSymbols()...)
+		template.Policy = SafePolicy()
+		return template
+	}
+
+	var buf bytes.Buffer
+	newTemplate().
+		MustParseString(`<$ import "strings" $><$ import "yaegi-template/helpers" $><$= strings.ToUpper(helpers.Slugify("Hello World")) $>`).
+		MustExec(&buf, nil)
+	require.Equal(t, "HELLO-WORLD", buf.String())
+
+	buf.Reset()
+	newTemplate().
+		MustParseString(`<$ import "fmt" $><$ s := ""; n, _ := fmt.Scan(&s); fmt.Println(n, s) $>`).
+		MustExec(&buf, nil)
+	require.Equal(t, "0 \n", buf.String())
+
+	for _, code := range []string{
+		`<$ import "os" $><$ os.Remove("x") $>`,
+		`<$ import "net/http" $><$ http.Get("http://example.com") $>`,
+		`<$ import "time" $><$ time.Sleep(time.Hour) $>`,
+	} {
+		err := newTemplate().ParseString(code)
+		if err == nil {
+			_, err = newTemplate().MustParseString(code).Exec(&buf, nil)
+		}
+		require.Error(t, err, code)
+	}
+
+	t.Run("Use", func(t *testing.T) {
+		template := newTemplate()
+		require.NoError(t, template.Use(stdlib.Symbols))
+		err := template.ParseString(`<$ import "os" $><$ os.Getenv("HOME") $>`)
+		if err == nil {
+			_, err = template.Exec(&buf, nil)
+		}
+		require.Error(t, err)
+	})
+}
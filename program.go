@@ -0,0 +1,421 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"go/scanner"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/Eun/yaegi-template/codebuffer"
+)
+
+var macroHeaderRegexp = regexp.MustCompile(`^macro\s+([A-Za-z_][A-Za-z0-9_]*)\s*\(`)
+
+var captureHeaderRegexp = regexp.MustCompile(`^capture\s+([A-Za-z_][A-Za-z0-9_]*)$`)
+
+// program is the go code that gets assembled from the parts of a template.
+type program struct {
+	// macros holds the function declarations of all macros, they get evaluated before the code.
+	macros bytes.Buffer
+	// code holds the main flow of the template.
+	code bytes.Buffer
+	// macro is the name of the macro that is currently being declared.
+	macro string
+	// captures holds the variable names of the capture blocks that are currently open.
+	captures []string
+	// meta holds the front matter of the template.
+	meta map[string]interface{}
+	// parts is the number of parts that were added.
+	parts int
+	// trackText is true if the text parts should be written with __text, so the escaper and the auto indentation
+	// can track them.
+	trackText bool
+	// autoIndent is true if the output of code blocks should be indented to the column of the block.
+	autoIndent bool
+	// frontMatter is true if the template can start with a front matter, see Template.FrontMatter.
+	frontMatter bool
+	// line holds the text of the current line, it is used to determine the column of code blocks.
+	line []byte
+	// filters are the filters that can be used in expression pipelines.
+	filters filters
+	// trace is true if the code parts should report their start with __block, see Tracer.
+	trace bool
+
+	// constantPrefix is used by the go code generator, if set the text parts are collected in texts and
+	// referenced by constants named constantPrefix + index.
+	constantPrefix string
+	texts          [][]byte
+	// macroDecls holds the variable declarations of the macros for the go code generator.
+	macroDecls []string
+	// valueFunc is the function the go code generator uses to format the values of expression blocks.
+	valueFunc string
+	// hasValues is true if the program contains expression blocks.
+	hasValues bool
+	// sources holds the parts of the template, __text references the text parts by their index.
+	sources []codebuffer.Part
+	// positions maps the code that was written from the code parts to the position in the template.
+	positions []codePosition
+}
+
+// codePosition is the position of code in the template, that was written to the macros or the code.
+type codePosition struct {
+	macros bool
+	// offset is the offset of the code in the buffer.
+	offset int
+	// size is the size of the code, it is 0 if the code does not match the template (e.g. rewritten code).
+	size   int
+	line   int
+	column int
+}
+
+// addPart adds a part to the program.
+func (p *program) addPart(part *codebuffer.Part) error {
+	p.parts++
+	switch part.Type {
+	case codebuffer.CodePartType:
+		p.sources = append(p.sources, *part)
+		return p.addCodePart(part.Content)
+	case codebuffer.TextPartType:
+		source := *part
+		if p.parts == 1 && p.frontMatter {
+			// only the beginning of the template can contain a front matter
+			var err error
+			p.meta, source.Content, err = parseFrontMatter(part.Content)
+			if err != nil {
+				return err
+			}
+			if len(source.Content) == 0 {
+				return nil
+			}
+			source.Line, source.Column = advancePosition(part.Line, part.Column,
+				part.Content[:len(part.Content)-len(source.Content)])
+		}
+		p.sources = append(p.sources, source)
+		return p.addTextPart(source.Content)
+	}
+	return nil
+}
+
+// advancePosition returns the position after b.
+func advancePosition(line, column int, b []byte) (int, int) {
+	for _, r := range string(b) {
+		if r == '\n' {
+			line++
+			column = 1
+			continue
+		}
+		column++
+	}
+	return line, column
+}
+
+func (p *program) addCodePart(content []byte) error {
+	trimmed := bytes.TrimSpace(content)
+	// start is the offset of trimmed in content
+	start := len(content) - len(bytes.TrimLeft(content, " \t\r\n"))
+	if p.trace && !bytes.HasPrefix(trimmed, []byte("import")) {
+		if tracedAfter(trimmed) {
+			defer func() {
+				_ = p.traceBlock()
+			}()
+		} else if err := p.traceBlock(); err != nil {
+			return errors.Wrap(err, "unable to write code part")
+		}
+	}
+	if indent := p.indentation(); indent != "" && isSimpleStatement(trimmed) {
+		// the output of the code block gets indented to the column of the block
+		if err := p.write(p.current(), "__indent(", strconv.Quote(indent), ")\n"); err != nil {
+			return errors.Wrap(err, "unable to write code part")
+		}
+		defer func() {
+			_ = p.write(p.current(), "__indent(\"\")\n")
+		}()
+	}
+
+	if m := macroHeaderRegexp.FindSubmatch(trimmed); m != nil {
+		if p.macro != "" {
+			return errors.Errorf("unable to declare macro %s inside of macro %s", m[1], p.macro)
+		}
+		if len(p.captures) > 0 {
+			return errors.Errorf("unable to declare macro %s inside of capture %s", m[1], p.captures[len(p.captures)-1])
+		}
+		p.macro = string(m[1])
+		if p.constantPrefix != "" {
+			// macro Card(title string) => Card = func(title string) {
+			signature := "func" + string(trimmed[len(m[0])-1:])
+			p.macroDecls = append(p.macroDecls, "var "+p.macro+" "+signature)
+			return p.write(&p.macros, p.macro, " = ", signature, " {\n")
+		}
+		// macro Card(title string) => func Card(title string) {
+		if err := p.write(&p.macros, "func"); err != nil {
+			return err
+		}
+		header := trimmed[len("macro"):]
+		p.mark(&p.macros, start+len("macro"), len(header))
+		return p.write(&p.macros, string(header), " {\n")
+	}
+
+	if bytes.HasPrefix(trimmed, []byte("=")) {
+		expr := bytes.TrimSpace(trimmed[1:])
+		offset := start + 1
+		if len(expr) > 0 {
+			offset = start + bytes.Index(trimmed, expr)
+		}
+		return p.addExpression(string(expr), offset)
+	}
+
+	if m := captureHeaderRegexp.FindSubmatch(trimmed); m != nil {
+		if p.constantPrefix != "" {
+			return errors.Errorf("capture %s: capture blocks are not supported by the go code generator", m[1])
+		}
+		// capture x => x := capture(func() {
+		p.captures = append(p.captures, string(m[1]))
+		p.mark(p.current(), start, 0)
+		return p.write(p.current(), string(m[1]), " := capture(func() {\n")
+	}
+
+	if n := len(p.captures); n > 0 && string(trimmed) == "end" {
+		p.captures = p.captures[:n-1]
+		return p.write(p.current(), "})\n")
+	}
+
+	if p.macro != "" && string(trimmed) == "end" {
+		p.macro = ""
+		return p.write(&p.macros, "}\n")
+	}
+
+	if err := p.writeCode(content); err != nil {
+		return errors.Wrap(err, "unable to write code part")
+	}
+	if _, err := p.current().WriteRune('\n'); err != nil {
+		return errors.Wrap(err, "unable to write code part")
+	}
+	return nil
+}
+
+// writeCode writes the content of a code part.
+// The go statements are rewritten (see rewriteGoStatement), so the panics of the goroutines get recovered, go
+// statements that continue in another code part can not be rewritten and are rejected.
+// The go code generator keeps them.
+func (p *program) writeCode(content []byte) error {
+	offset := 0
+	if p.constantPrefix == "" {
+		statements, incomplete := findGoStatements(content)
+		if incomplete >= 0 {
+			line, column := p.partPosition(incomplete)
+			return errors.Errorf("go statement at %d:%d continues in another code part, its panics could not be recovered", line, column)
+		}
+		for _, stmt := range statements {
+			p.mark(p.current(), offset, stmt.start-offset)
+			if _, err := p.current().Write(content[offset:stmt.start]); err != nil {
+				return err
+			}
+			p.mark(p.current(), stmt.start, 0)
+			if _, err := p.current().WriteString(p.rewriteGo(stmt.start, string(content[stmt.start:stmt.end]))); err != nil {
+				return err
+			}
+			offset = stmt.end
+		}
+	}
+	p.mark(p.current(), offset, len(content)-offset)
+	_, err := p.current().Write(content[offset:])
+	return err
+}
+
+// rewriteGo rewrites the go statements of code, offset is the offset of code in the current code part.
+func (p *program) rewriteGo(offset int, code string) string {
+	statements, _ := findGoStatements([]byte(code))
+	if len(statements) == 0 {
+		return code
+	}
+	var sb strings.Builder
+	last := 0
+	for _, stmt := range statements {
+		sb.WriteString(code[last:stmt.start])
+		line, column := p.partPosition(offset + stmt.start)
+		sb.WriteString(rewriteGoStatement(stmt, line, column, func(o int, c string) string {
+			return p.rewriteGo(offset+o, c)
+		}))
+		last = stmt.end
+	}
+	sb.WriteString(code[last:])
+	return sb.String()
+}
+
+// addExpression adds an expression block (<$= expr $>), the value of the expression gets written to the output.
+// offset is the offset of the expression in the current code part.
+func (p *program) addExpression(expr string, offset int) error {
+	if expr == "" {
+		return errors.New("expression block is empty")
+	}
+	pipeline := expr
+	expr, err := p.filters.rewritePipeline(pipeline)
+	if err != nil {
+		return errors.Wrapf(err, "expression %q", pipeline)
+	}
+	p.hasValues = true
+	if p.constantPrefix != "" {
+		if expr != pipeline {
+			return errors.Errorf("expression %q: filters are not supported by the go code generator", pipeline)
+		}
+		return p.write(p.current(), "print(", p.valueFunc, "(", expr, "))\n")
+	}
+	if err := p.write(p.current(), "__print("); err != nil {
+		return err
+	}
+	size := len(expr)
+	if expr != pipeline {
+		size = 0
+	}
+	p.mark(p.current(), offset, size)
+	return p.write(p.current(), expr, ")\n")
+}
+
+func (p *program) addTextPart(content []byte) error {
+	if i := bytes.LastIndexByte(content, '\n'); i >= 0 {
+		p.line = append(p.line[:0], content[i+1:]...)
+	} else {
+		p.line = append(p.line, content...)
+	}
+	if p.constantPrefix != "" {
+		p.texts = append(p.texts, content)
+		if err := p.write(p.current(), "print(", p.constantPrefix, strconv.Itoa(len(p.texts)-1), ")\n"); err != nil {
+			return errors.Wrap(err, "unable to write text part")
+		}
+		return nil
+	}
+	printFunc := "print("
+	if p.trackText {
+		printFunc = "__text(" + strconv.Itoa(len(p.sources)-1) + ", "
+	}
+	if err := p.write(p.current(), printFunc, strconv.Quote(string(content)), ")\n"); err != nil {
+		return errors.Wrap(err, "unable to write text part")
+	}
+	return nil
+}
+
+// traceBlock writes the call that reports the start of the current code part to the Tracer.
+func (p *program) traceBlock() error {
+	return p.write(p.current(), "__block(", strconv.Itoa(len(p.sources)-1), ")\n")
+}
+
+// indentation returns the indentation for the output of a code block at the current column,
+// an empty string is returned if auto indentation is disabled.
+// The indentation consists of the tabs of the current line, all other characters are replaced with spaces.
+func (p *program) indentation() string {
+	if !p.autoIndent || len(p.line) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, r := range string(p.line) {
+		if r == '\t' {
+			sb.WriteRune(r)
+			continue
+		}
+		sb.WriteRune(' ')
+	}
+	return sb.String()
+}
+
+// isSimpleStatement returns true if code is an expression block or a statement block that starts with an identifier
+// and has balanced braces, e.g. print(x) or Card("title"). Only the output of these blocks is indented automatically,
+// other blocks (e.g. for loops, case clauses or declarations) cannot be wrapped with other statements.
+func isSimpleStatement(code []byte) bool {
+	if bytes.HasPrefix(code, []byte("=")) {
+		return true
+	}
+	if macroHeaderRegexp.Match(code) || captureHeaderRegexp.Match(code) || string(code) == "end" {
+		return false
+	}
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", fset.Base(), len(code)), code, nil, 0)
+	depth := 0
+	for i := 0; ; i++ {
+		_, tok, _ := s.Scan()
+		switch {
+		case tok == token.EOF:
+			return depth == 0
+		case i == 0 && tok != token.IDENT:
+			return false
+		case tok == token.LBRACE:
+			depth++
+		case tok == token.RBRACE:
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+}
+
+// finish must be called after all parts were added.
+func (p *program) finish() error {
+	if n := len(p.captures); n > 0 {
+		return errors.Errorf("capture %s was not closed, missing end", p.captures[n-1])
+	}
+	if p.macro != "" {
+		return errors.Errorf("macro %s was not closed, missing end", p.macro)
+	}
+	return nil
+}
+
+// mark records that the code, that gets written next to buf, is located at offset of the current code part.
+// size is the size of the code, 0 means that the code does not match the template.
+func (p *program) mark(buf *bytes.Buffer, offset, size int) {
+	line, column := p.partPosition(offset)
+	p.positions = append(p.positions, codePosition{
+		macros: buf == &p.macros,
+		offset: buf.Len(),
+		size:   size,
+		line:   line,
+		column: column,
+	})
+}
+
+// partPosition returns the position in the template of offset of the current code part.
+func (p *program) partPosition(offset int) (line, column int) {
+	part := p.sources[len(p.sources)-1]
+	return advancePosition(part.Line, part.Column, part.Content[:offset])
+}
+
+// position returns the position in the template of the code at offset of the macros or the code,
+// 0, 0 is returned if the offset does not belong to a code part.
+func (p *program) position(macros bool, offset int) (line, column int) {
+	buf := p.code.Bytes()
+	if macros {
+		buf = p.macros.Bytes()
+	}
+	for i := len(p.positions) - 1; i >= 0; i-- {
+		pos := p.positions[i]
+		if pos.macros != macros || pos.offset > offset {
+			continue
+		}
+		if offset-pos.offset > pos.size {
+			return pos.line, pos.column
+		}
+		return advancePosition(pos.line, pos.column, buf[pos.offset:offset])
+	}
+	return 0, 0
+}
+
+// current returns the buffer that the parts should be written to.
+func (p *program) current() *bytes.Buffer {
+	if p.macro != "" {
+		return &p.macros
+	}
+	return &p.code
+}
+
+func (*program) write(buf *bytes.Buffer, s ...string) error {
+	for i := range s {
+		if _, err := buf.WriteString(s[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
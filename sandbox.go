@@ -0,0 +1,580 @@
+package yaegi_template
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+// sandboxedPackages are the packages that get replaced by a Sandbox.
+var sandboxedPackages = []string{"os/os", "io/ioutil/ioutil", "path/filepath/filepath"}
+
+// SandboxFile is a file that was opened inside of a Sandbox.
+type SandboxFile interface {
+	io.Reader
+	io.Closer
+	Stat() (os.FileInfo, error)
+}
+
+// sandboxReader provides read access to the files of a sandbox.
+// The names are slash separated, clean and relative to the root of the sandbox ("." is the root).
+type sandboxReader interface {
+	open(name string) (SandboxFile, error)
+	stat(name string) (os.FileInfo, error)
+	// lstat does not follow the link name.
+	lstat(name string) (os.FileInfo, error)
+	readDir(name string) ([]os.FileInfo, error)
+}
+
+// Sandbox confines the file access of templates to a directory (see NewSandbox) or a file system (see NewFSSandbox).
+// The sandbox replaces the os, io/ioutil and path/filepath packages, all paths are relative to the root of the
+// sandbox:
+//    sandbox, err := yaegi_template.NewSandbox("templates/data")
+//    template := yaegi_template.MustNew(yaegi_template.DefaultOptions(), sandbox.Replace(yaegi_template.DefaultSymbols()...)...)
+//    template.MustParseString(`<$ import "io/ioutil" $><$ b, _ := ioutil.ReadFile("users.json") $>...`)
+// The sandboxed os package only contains the functions to access files.
+// Other packages of the standard library, that access files (e.g. text/template.ParseFiles), are not sandboxed,
+// use SafeSymbols() and SafePolicy() to remove them, the sandboxed packages are not restricted by the Allow list of a
+// Policy, but by its Deny list:
+//    template := yaegi_template.MustNew(yaegi_template.DefaultOptions(), sandbox.Replace(yaegi_template.SafeSymbols()...)...)
+//    template.Policy = yaegi_template.SafePolicy()
+type Sandbox struct {
+	fs       sandboxReader
+	dir      *dirSandbox
+	writable bool
+}
+
+// NewSandbox returns a read-only sandbox for the directory root.
+func NewSandbox(root string) (*Sandbox, error) {
+	dir, err := newDirSandbox(root)
+	if err != nil {
+		return nil, err
+	}
+	return &Sandbox{fs: dir, dir: dir}, nil
+}
+
+// NewWritableSandbox returns a sandbox for the directory root, templates can create, modify and remove files
+// inside of root.
+func NewWritableSandbox(root string) (*Sandbox, error) {
+	s, err := NewSandbox(root)
+	if err != nil {
+		return nil, err
+	}
+	s.writable = true
+	return s, nil
+}
+
+// MustNewSandbox is like NewSandbox, except it panics on failure.
+func MustNewSandbox(root string) *Sandbox {
+	s, err := NewSandbox(root)
+	if err != nil {
+		panic(err.Error())
+	}
+	return s
+}
+
+// Replace returns the exports with the os, io/ioutil and path/filepath packages replaced by the sandboxed ones.
+func (s *Sandbox) Replace(exports ...interp.Exports) []interp.Exports {
+	result := make([]interp.Exports, 0, len(exports)+1)
+	for _, e := range exports {
+		filtered := make(interp.Exports, len(e))
+		for key, symbols := range e {
+			filtered[key] = symbols
+		}
+		for _, key := range sandboxedPackages {
+			delete(filtered, key)
+		}
+		result = append(result, filtered)
+	}
+	return append(result, s.Exports())
+}
+
+// Exports returns the sandboxed os, io/ioutil and path/filepath packages.
+func (s *Sandbox) Exports() interp.Exports {
+	osSymbols := copySymbols("os/os",
+		"ErrClosed", "ErrExist", "ErrInvalid", "ErrNotExist", "ErrPermission",
+		"IsExist", "IsNotExist", "IsPermission",
+		"FileInfo", "FileMode", "PathError", "LinkError",
+		"ModeDir", "ModePerm", "ModeSymlink", "ModeType",
+		"PathSeparator", "PathListSeparator",
+	)
+	osSymbols["Open"] = reflect.ValueOf(s.Open)
+	osSymbols["Stat"] = reflect.ValueOf(s.Stat)
+	osSymbols["Lstat"] = reflect.ValueOf(s.Lstat)
+	osSymbols["ReadFile"] = reflect.ValueOf(s.ReadFile)
+	osSymbols["Create"] = reflect.ValueOf(s.Create)
+	osSymbols["WriteFile"] = reflect.ValueOf(s.WriteFile)
+	osSymbols["Mkdir"] = reflect.ValueOf(s.Mkdir)
+	osSymbols["MkdirAll"] = reflect.ValueOf(s.MkdirAll)
+	osSymbols["Remove"] = reflect.ValueOf(s.Remove)
+	osSymbols["RemoveAll"] = reflect.ValueOf(s.RemoveAll)
+	osSymbols["Rename"] = reflect.ValueOf(s.Rename)
+
+	ioutilSymbols := copySymbols("io/ioutil/ioutil", "Discard", "NopCloser", "ReadAll")
+	ioutilSymbols["ReadFile"] = reflect.ValueOf(s.ReadFile)
+	ioutilSymbols["ReadDir"] = reflect.ValueOf(s.ReadDir)
+	ioutilSymbols["WriteFile"] = reflect.ValueOf(s.WriteFile)
+
+	filepathSymbols := copySymbols("path/filepath/filepath",
+		"Base", "Clean", "Dir", "Ext", "FromSlash", "IsAbs", "Join", "Match", "Rel", "Split", "SplitList",
+		"ToSlash", "VolumeName", "Separator", "ListSeparator", "ErrBadPattern", "SkipDir", "WalkFunc",
+	)
+	filepathSymbols["Glob"] = reflect.ValueOf(s.Glob)
+	filepathSymbols["Walk"] = reflect.ValueOf(s.Walk)
+
+	return interp.Exports{
+		"os/os":                  osSymbols,
+		"io/ioutil/ioutil":       ioutilSymbols,
+		"path/filepath/filepath": filepathSymbols,
+	}
+}
+
+// sandboxSymbols are the symbols of a sandbox, they are used to recognize the symbols of sandboxes.
+var sandboxSymbols = (&Sandbox{}).Exports()
+
+// isSandboxPackage returns true if the symbols of the package key were exported by a Sandbox, they contain at least
+// one method of a sandbox. The copies of the standard library (e.g. os.IsNotExist) do not count.
+func isSandboxPackage(key string, symbols map[string]reflect.Value) bool {
+	for name, symbol := range sandboxSymbols[key] {
+		if symbol.Kind() != reflect.Func {
+			continue
+		}
+		if original, ok := stdlib.Symbols[key][name]; ok && original.Pointer() == symbol.Pointer() {
+			continue
+		}
+		if value, ok := symbols[name]; ok && value.Kind() == reflect.Func && value.Pointer() == symbol.Pointer() {
+			return true
+		}
+	}
+	return false
+}
+
+// isSandboxSymbol returns true if value is the symbol name of the package key of a sandbox.
+// The functions of all sandboxes share the code pointers of the methods, the other symbols are copies of harmless
+// symbols of the standard library (e.g. os.IsNotExist).
+func isSandboxSymbol(key, name string, value reflect.Value) bool {
+	symbol, ok := sandboxSymbols[key][name]
+	if !ok || !value.IsValid() || value.Kind() != symbol.Kind() {
+		return false
+	}
+	if symbol.Kind() == reflect.Func {
+		return value.Pointer() == symbol.Pointer()
+	}
+	return true
+}
+
+// copySymbols copies the symbols with the specified names and the interface wrappers of a standard package.
+func copySymbols(key string, names ...string) map[string]reflect.Value {
+	symbols := make(map[string]reflect.Value)
+	for name, value := range stdlib.Symbols[key] {
+		if strings.HasPrefix(name, "_") {
+			symbols[name] = value
+		}
+	}
+	for _, name := range names {
+		if value, ok := stdlib.Symbols[key][name]; ok {
+			symbols[name] = value
+		}
+	}
+	return symbols
+}
+
+// sandboxPath converts the name to a clean slash separated path relative to the root of the sandbox,
+// names can not leave the root: "/a", "a", "../a" and "a/../../a" all refer to "a".
+func sandboxPath(name string) string {
+	p := path.Clean("/" + filepath.ToSlash(name))
+	if p == "/" {
+		return "."
+	}
+	return p[1:]
+}
+
+// sandboxError returns an error for the operation on name, that does not reveal the location of the sandbox.
+func sandboxError(op, name string, err error) error {
+	switch e := err.(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// Open opens the file name for reading.
+func (s *Sandbox) Open(name string) (SandboxFile, error) {
+	f, err := s.fs.open(sandboxPath(name))
+	if err != nil {
+		return nil, sandboxError("open", name, err)
+	}
+	return f, nil
+}
+
+// Stat returns the os.FileInfo of the file name.
+func (s *Sandbox) Stat(name string) (os.FileInfo, error) {
+	info, err := s.fs.stat(sandboxPath(name))
+	if err != nil {
+		return nil, sandboxError("stat", name, err)
+	}
+	return info, nil
+}
+
+// Lstat returns the os.FileInfo of the file name, if it is a symbolic link, the link is described.
+func (s *Sandbox) Lstat(name string) (os.FileInfo, error) {
+	info, err := s.fs.lstat(sandboxPath(name))
+	if err != nil {
+		return nil, sandboxError("lstat", name, err)
+	}
+	return info, nil
+}
+
+// ReadFile reads the file name.
+func (s *Sandbox) ReadFile(name string) ([]byte, error) {
+	f, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, sandboxError("read", name, err)
+	}
+	return b, nil
+}
+
+// ReadDir reads the directory name and returns its entries sorted by name.
+func (s *Sandbox) ReadDir(name string) ([]os.FileInfo, error) {
+	infos, err := s.fs.readDir(sandboxPath(name))
+	if err != nil {
+		return nil, sandboxError("readdir", name, err)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	return infos, nil
+}
+
+// Glob returns the names of all files matching pattern, see filepath.Glob.
+func (s *Sandbox) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	var matches []string
+	if err := s.glob(sandboxPath(pattern), &matches); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(filepath.ToSlash(pattern), "/") {
+		for i := range matches {
+			matches[i] = "/" + matches[i]
+		}
+	}
+	for i := range matches {
+		matches[i] = filepath.FromSlash(matches[i])
+	}
+	return matches, nil
+}
+
+func (s *Sandbox) glob(pattern string, matches *[]string) error {
+	dir, file := path.Split(pattern)
+	dir = strings.TrimSuffix(dir, "/")
+	if dir == "" {
+		dir = "."
+	}
+	if !hasMeta(dir) {
+		return s.globDir(dir, file, matches)
+	}
+	var dirs []string
+	if err := s.glob(dir, &dirs); err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		if err := s.globDir(d, file, matches); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sandbox) globDir(dir, pattern string, matches *[]string) error {
+	if !hasMeta(pattern) {
+		name := path.Join(dir, pattern)
+		if _, err := s.fs.stat(name); err == nil {
+			*matches = append(*matches, name)
+		}
+		return nil
+	}
+	infos, err := s.fs.readDir(dir)
+	if err != nil {
+		// like filepath.Glob, unreadable directories are ignored
+		return nil
+	}
+	var names []string
+	for _, info := range infos {
+		if ok, _ := path.Match(pattern, info.Name()); ok {
+			names = append(names, path.Join(dir, info.Name()))
+		}
+	}
+	sort.Strings(names)
+	*matches = append(*matches, names...)
+	return nil
+}
+
+func hasMeta(p string) bool {
+	return strings.ContainsAny(p, `*?[\`)
+}
+
+// Walk walks the file tree rooted at root, see filepath.Walk.
+// The paths that are passed to fn start with root.
+func (s *Sandbox) Walk(root string, fn filepath.WalkFunc) error {
+	info, err := s.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = s.walk(root, info, fn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (s *Sandbox) walk(name string, info os.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(name, info, nil)
+	}
+	infos, err := s.ReadDir(name)
+	if err := fn(name, info, err); err != nil || infos == nil {
+		return err
+	}
+	for _, child := range infos {
+		err := s.walk(filepath.Join(name, child.Name()), child, fn)
+		if err != nil {
+			if !child.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writableDir returns the directory of a writable sandbox.
+func (s *Sandbox) writableDir(op, name string) (*dirSandbox, error) {
+	if !s.writable || s.dir == nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrPermission}
+	}
+	return s.dir, nil
+}
+
+// Create creates or truncates the file name.
+func (s *Sandbox) Create(name string) (io.WriteCloser, error) {
+	dir, err := s.writableDir("open", name)
+	if err != nil {
+		return nil, err
+	}
+	p, err := dir.resolve(sandboxPath(name))
+	if err != nil {
+		return nil, sandboxError("open", name, err)
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return nil, sandboxError("open", name, err)
+	}
+	return writeOnlyFile{f}, nil
+}
+
+// WriteFile writes data to the file name, see ioutil.WriteFile.
+func (s *Sandbox) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return s.write("open", name, func(p string) error {
+		return ioutil.WriteFile(p, data, perm)
+	})
+}
+
+// Mkdir creates the directory name.
+func (s *Sandbox) Mkdir(name string, perm os.FileMode) error {
+	return s.write("mkdir", name, func(p string) error {
+		return os.Mkdir(p, perm)
+	})
+}
+
+// MkdirAll creates the directory name and all missing parents.
+func (s *Sandbox) MkdirAll(name string, perm os.FileMode) error {
+	return s.write("mkdir", name, func(p string) error {
+		return os.MkdirAll(p, perm)
+	})
+}
+
+// Remove removes the file or empty directory name, a symbolic link is removed itself.
+func (s *Sandbox) Remove(name string) error {
+	return s.writeEntry("remove", name, os.Remove)
+}
+
+// RemoveAll removes name and all its children, the root of the sandbox can not be removed.
+// A symbolic link is removed itself, not the files it points to.
+func (s *Sandbox) RemoveAll(name string) error {
+	if sandboxPath(name) == "." {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrPermission}
+	}
+	return s.writeEntry("remove", name, os.RemoveAll)
+}
+
+// Rename renames the file oldName to newName, symbolic links are renamed themselves.
+func (s *Sandbox) Rename(oldName, newName string) error {
+	dir, err := s.writableDir("rename", oldName)
+	if err != nil {
+		return err
+	}
+	oldPath, err := dir.resolveParent(sandboxPath(oldName))
+	if err != nil {
+		return sandboxError("rename", oldName, err)
+	}
+	return s.writeEntry("rename", newName, func(newPath string) error {
+		return os.Rename(oldPath, newPath)
+	})
+}
+
+// write calls fn with the resolved path of name.
+func (s *Sandbox) write(op, name string, fn func(p string) error) error {
+	return s.writePath(op, name, false, fn)
+}
+
+// writeEntry is like write, but the last element of name is not resolved, so operations on the directory entry
+// (e.g. os.Remove) do not follow a link.
+func (s *Sandbox) writeEntry(op, name string, fn func(p string) error) error {
+	return s.writePath(op, name, true, fn)
+}
+
+func (s *Sandbox) writePath(op, name string, entry bool, fn func(p string) error) error {
+	dir, err := s.writableDir(op, name)
+	if err != nil {
+		return err
+	}
+	resolve := dir.resolve
+	if entry {
+		resolve = dir.resolveParent
+	}
+	p, err := resolve(sandboxPath(name))
+	if err != nil {
+		return sandboxError(op, name, err)
+	}
+	if err := fn(p); err != nil {
+		return sandboxError(op, name, err)
+	}
+	return nil
+}
+
+// dirSandbox provides access to the files inside of a directory.
+type dirSandbox struct {
+	root string
+}
+
+func newDirSandbox(root string) (*dirSandbox, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to resolve sandbox root %q", root)
+	}
+	abs, err = filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to resolve sandbox root %q", root)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to stat sandbox root %q", root)
+	}
+	if !info.IsDir() {
+		return nil, errors.Errorf("sandbox root %q is not a directory", root)
+	}
+	return &dirSandbox{root: abs}, nil
+}
+
+// resolve returns the path of name on disk, symbolic links that point outside of the root are rejected.
+func (d *dirSandbox) resolve(name string) (string, error) {
+	return resolveInRoot(d.root, filepath.Join(d.root, filepath.FromSlash(name)))
+}
+
+// resolveParent is like resolve, but the last element of name is not resolved, like os.Lstat does not follow a
+// link.
+func (d *dirSandbox) resolveParent(name string) (string, error) {
+	if name == "." {
+		return d.root, nil
+	}
+	dir, err := d.resolve(path.Dir(name))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, path.Base(name)), nil
+}
+
+func (d *dirSandbox) open(name string) (SandboxFile, error) {
+	p, err := d.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	return readOnlyFile{f}, nil
+}
+
+func (d *dirSandbox) stat(name string) (os.FileInfo, error) {
+	p, err := d.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(p)
+}
+
+func (d *dirSandbox) lstat(name string) (os.FileInfo, error) {
+	p, err := d.resolveParent(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Lstat(p)
+}
+
+func (d *dirSandbox) readDir(name string) ([]os.FileInfo, error) {
+	p, err := d.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadDir(p)
+}
+
+// readOnlyFile hides the methods of os.File that are not part of SandboxFile, like Name() (it would reveal the
+// location of the sandbox) or Chdir().
+type readOnlyFile struct {
+	f *os.File
+}
+
+func (r readOnlyFile) Read(p []byte) (int, error) {
+	return r.f.Read(p)
+}
+
+func (r readOnlyFile) Close() error {
+	return r.f.Close()
+}
+
+func (r readOnlyFile) Stat() (os.FileInfo, error) {
+	return r.f.Stat()
+}
+
+// writeOnlyFile hides the methods of os.File that are not part of io.WriteCloser.
+type writeOnlyFile struct {
+	f *os.File
+}
+
+func (w writeOnlyFile) Write(p []byte) (int, error) {
+	return w.f.Write(p)
+}
+
+func (w writeOnlyFile) Close() error {
+	return w.f.Close()
+}
@@ -0,0 +1,48 @@
+//go:build go1.16
+// +build go1.16
+
+package yaegi_template
+
+import (
+	"io/fs"
+	"os"
+)
+
+// NewFSSandbox returns a read-only sandbox for the file system fsys.
+func NewFSSandbox(fsys fs.FS) *Sandbox {
+	return &Sandbox{fs: fsSandbox{fsys}}
+}
+
+// fsSandbox provides access to the files of a fs.FS.
+type fsSandbox struct {
+	fsys fs.FS
+}
+
+func (f fsSandbox) open(name string) (SandboxFile, error) {
+	return f.fsys.Open(name)
+}
+
+func (f fsSandbox) stat(name string) (os.FileInfo, error) {
+	return fs.Stat(f.fsys, name)
+}
+
+// lstat is like stat, a fs.FS does not expose links.
+func (f fsSandbox) lstat(name string) (os.FileInfo, error) {
+	return f.stat(name)
+}
+
+func (f fsSandbox) readDir(name string) ([]os.FileInfo, error) {
+	entries, err := fs.ReadDir(f.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
@@ -0,0 +1,24 @@
+//go:build go1.16
+// +build go1.16
+
+package yaegi_template
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFSSandbox(t *testing.T) {
+	sandbox := NewFSSandbox(fstest.MapFS{
+		"data/a.txt": &fstest.MapFile{Data: []byte("A")},
+		"data/b.txt": &fstest.MapFile{Data: []byte("B")},
+	})
+
+	out, err := execSandbox(t, sandbox, `<$ import "io/ioutil" $><$ import "path/filepath" $><$ import "os" $>
+<$- a, _ := ioutil.ReadFile("/data/a.txt"); matches, _ := filepath.Glob("data/*") $><$= string(a) $> <$= matches $>
+<$- err := os.WriteFile("data/c.txt", nil, 0600) $> <$= err $>`)
+	require.NoError(t, err)
+	require.Equal(t, "A [data/a.txt data/b.txt] open data/c.txt: permission denied", out)
+}
@@ -0,0 +1,169 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/yaegi/interp"
+)
+
+func newSandboxDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "yaegi-template")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+	root := filepath.Join(dir, "root")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "data"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "data", "a.txt"), []byte("A"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "data", "b.txt"), []byte("B"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0600))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(root, "link.txt")))
+	return root
+}
+
+func execSandbox(t *testing.T, sandbox *Sandbox, code string) (string, error) {
+	template := MustNew(interp.Options{}, sandbox.Replace(DefaultSymbols()...)...)
+	if err := template.ParseString(code); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	_, err := template.Exec(&buf, nil)
+	return buf.String(), err
+}
+
+func TestSandbox(t *testing.T) {
+	root := newSandboxDir(t)
+	sandbox := MustNewSandbox(root)
+
+	t.Run("read", func(t *testing.T) {
+		out, err := execSandbox(t, sandbox, `<$ import "io/ioutil" $><$ import "os" $>
+<$- a, _ := ioutil.ReadFile("data/a.txt"); b, _ := os.ReadFile("/data/b.txt") $><$= string(a) + string(b) $>`)
+		require.NoError(t, err)
+		require.Equal(t, "AB", out)
+	})
+
+	t.Run("traversal", func(t *testing.T) {
+		out, err := execSandbox(t, sandbox, `<$ import "io/ioutil" $>
+<$- _, err := ioutil.ReadFile("../secret.txt") $><$= err $>`)
+		require.NoError(t, err)
+		require.Equal(t, "open ../secret.txt: no such file or directory", out)
+
+		out, err = execSandbox(t, sandbox, `<$ import "io/ioutil" $>
+<$- _, err := ioutil.ReadFile("link.txt") $><$= err $>`)
+		require.NoError(t, err)
+		require.Equal(t, "open link.txt: permission denied", out)
+	})
+
+	t.Run("glob and walk", func(t *testing.T) {
+		out, err := execSandbox(t, sandbox, `<$ import "path/filepath" $><$ import "os" $>
+<$- matches, _ := filepath.Glob("data/*.txt") $><$= matches $>
+<$ filepath.Walk("data", func(p string, info os.FileInfo, err error) error { print(p + ";"); return nil }) $>`)
+		require.NoError(t, err)
+		require.Equal(t, "[data/a.txt data/b.txt]\ndata;data/a.txt;data/b.txt;", out)
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		out, err := execSandbox(t, sandbox, `<$ import "os" $>
+<$- err := os.Remove("data/a.txt") $><$= err $>`)
+		require.NoError(t, err)
+		require.Equal(t, "remove data/a.txt: permission denied", out)
+		require.FileExists(t, filepath.Join(root, "data", "a.txt"))
+	})
+
+	t.Run("no other os symbols", func(t *testing.T) {
+		_, err := execSandbox(t, sandbox, `<$ import "os" $><$ os.Exit(1) $>`)
+		require.Error(t, err)
+	})
+
+	t.Run("policy", func(t *testing.T) {
+		template := MustNew(interp.Options{}, sandbox.Replace(SafeSymbols()...)...)
+		template.Policy = SafePolicy()
+		template.MustParseString(`<$ import "io/ioutil" $><$ import "path/filepath" $>
+<$- a, err := ioutil.ReadFile("data/a.txt") $><$= string(a) $> <$= err $> <$= filepath.Base("x/y") $>`)
+		var buf bytes.Buffer
+		_, err := template.Exec(&buf, nil)
+		require.NoError(t, err)
+		require.Equal(t, "A  y", buf.String())
+
+		// packages that are not sandboxed are still restricted
+		template = MustNew(interp.Options{}, sandbox.Replace(DefaultSymbols()...)...)
+		template.Policy = SafePolicy()
+		template.MustParseString(`<$ import "text/template" $><$ template.ParseFiles("/etc/passwd") $>`)
+		_, err = template.Exec(&buf, nil)
+		require.Error(t, err)
+		template.MustParseString(`<$ import "os" $><$ os.Exit(1) $>`)
+		_, err = template.Exec(&buf, nil)
+		require.Error(t, err)
+
+		// without a sandbox the os package is restricted
+		template = MustNew(interp.Options{}, DefaultSymbols()...)
+		template.Policy = &Policy{Deny: []string{"os"}}
+		template.MustParseString(`<$ import "os" $><$= os.IsNotExist(os.ErrNotExist) $>`)
+		_, err = template.Exec(&buf, nil)
+		require.Error(t, err)
+	})
+}
+
+func TestWritableSandbox(t *testing.T) {
+	root := newSandboxDir(t)
+	sandbox, err := NewWritableSandbox(root)
+	require.NoError(t, err)
+
+	t.Run("deny", func(t *testing.T) {
+		root := newSandboxDir(t)
+		sandbox, err := NewWritableSandbox(root)
+		require.NoError(t, err)
+		template := MustNew(interp.Options{}, sandbox.Replace(SafeSymbols()...)...)
+		template.Policy = &Policy{Deny: []string{"os.RemoveAll"}}
+		template.MustParseString(`<$ import "os" $><$ os.RemoveAll("data/a.txt") $>`)
+		_, err = template.Exec(&bytes.Buffer{}, nil)
+		require.Error(t, err)
+		_, err = os.Stat(filepath.Join(root, "data", "a.txt"))
+		require.NoError(t, err)
+	})
+
+	out, err := execSandbox(t, sandbox, `<$ import "os" $><$ import "io/ioutil" $>
+<$- os.MkdirAll("out/x", 0700); ioutil.WriteFile("../out/x/c.txt", []byte("C"), 0600); os.Remove("data/a.txt") $>
+<$- err := os.RemoveAll("/") $><$= err $>`)
+	require.NoError(t, err)
+	require.Equal(t, "remove /: permission denied", out)
+
+	b, err := ioutil.ReadFile(filepath.Join(root, "out", "x", "c.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "C", string(b))
+	require.NoFileExists(t, filepath.Join(root, "data", "a.txt"))
+
+	require.Error(t, sandbox.WriteFile("link.txt", []byte("x"), 0600))
+	b, err = ioutil.ReadFile(filepath.Join(filepath.Dir(root), "secret.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "secret", string(b))
+
+	t.Run("links", func(t *testing.T) {
+		require.NoError(t, os.Symlink(filepath.Join(root, "data", "b.txt"), filepath.Join(root, "alias.txt")))
+		require.NoError(t, os.Symlink(filepath.Join(root, "data"), filepath.Join(root, "dir")))
+		require.NoError(t, os.Symlink(filepath.Join(root, "data", "b.txt"), filepath.Join(root, "old.txt")))
+
+		out, err := execSandbox(t, sandbox, `<$ import "os" $>
+<$- info, _ := os.Lstat("alias.txt") $><$= info.Mode()&os.ModeSymlink != 0 $>
+<$- info, _ = os.Stat("alias.txt") $> <$= info.Mode()&os.ModeSymlink != 0 $>
+<$- os.Remove("alias.txt"); os.RemoveAll("dir"); os.Remove("link.txt"); os.Rename("old.txt", "new.txt") $>`)
+		require.NoError(t, err)
+		require.Equal(t, "true false", out)
+
+		// the links are gone, the files they pointed to are still there
+		for _, name := range []string{"alias.txt", "dir", "link.txt", "old.txt"} {
+			_, err := os.Lstat(filepath.Join(root, name))
+			require.True(t, os.IsNotExist(err), name)
+		}
+		info, err := os.Lstat(filepath.Join(root, "new.txt"))
+		require.NoError(t, err)
+		require.NotZero(t, info.Mode()&os.ModeSymlink)
+		require.FileExists(t, filepath.Join(root, "data", "b.txt"))
+		require.FileExists(t, filepath.Join(filepath.Dir(root), "secret.txt"))
+	})
+}
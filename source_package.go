@@ -0,0 +1,145 @@
+package yaegi_template
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sourcePackages holds go source packages that can be imported by templates, without being present on disk.
+// The key is the import path, the value are the files of the package (file name => source).
+type sourcePackages map[string]map[string]string
+
+// AddSourcePackage adds a go source package to the template, that can be imported from templates
+// with the specified import path.
+//    template.MustAddSourcePackage("acme/helpers", map[string]string{
+//        "helpers.go": `package helpers
+//    func Greet(name string) string { return "Hello " + name }`,
+//    })
+//    template.MustParseString(`<$ import "acme/helpers" $><$ print(helpers.Greet("Joe")) $>`)
+// Source packages must be added before the template gets parsed. The interpreter loads them from disk, so they are
+// written into a private temporary directory while imports are evaluated.
+func (t *Template) AddSourcePackage(importPath string, files map[string]string) error {
+	importPath = strings.Trim(importPath, "/")
+	if importPath == "" || path.Clean(importPath) != importPath || strings.HasPrefix(importPath, "..") {
+		return errors.Errorf("invalid import path %q", importPath)
+	}
+	if len(files) == 0 {
+		return errors.Errorf("source package %q has no files", importPath)
+	}
+	pkg := make(map[string]string, len(files))
+	for name, src := range files {
+		if name != filepath.Base(name) || strings.ContainsAny(name, `/\`) || !strings.HasSuffix(name, ".go") {
+			return errors.Errorf("invalid file name %q in source package %q", name, importPath)
+		}
+		pkg[name] = src
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.interp != nil {
+		return errors.New("source packages must be added before the template gets parsed")
+	}
+	if t.sourcePackages == nil {
+		t.sourcePackages = make(sourcePackages)
+	}
+	t.sourcePackages[importPath] = pkg
+	return nil
+}
+
+// MustAddSourcePackage is like AddSourcePackage, except it panics on failure.
+func (t *Template) MustAddSourcePackage(importPath string, files map[string]string) *Template {
+	if err := t.AddSourcePackage(importPath, files); err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// sourceRoot is the GOPATH of the interpreter of a template with source packages.
+// The interpreter needs a fixed GOPATH, so the root is a private directory that exists as long as the template, the
+// source packages are only written into it during the evaluation of imports.
+type sourceRoot struct {
+	dir string
+}
+
+// newSourceRoot creates a private temporary directory that will be used as GOPATH for the interpreter.
+func newSourceRoot() (*sourceRoot, error) {
+	dir, err := ioutil.TempDir("", "yaegi-template")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create source root")
+	}
+	root := &sourceRoot{dir: dir}
+	runtime.SetFinalizer(root, func(root *sourceRoot) {
+		_ = os.RemoveAll(root.dir)
+	})
+	return root, nil
+}
+
+// write writes all source packages into the root, the returned function removes them.
+// If goPath is not empty the packages inside goPath will be linked into the root, so they stay importable.
+func (root *sourceRoot) write(sp sourcePackages, goPath string) (func(), error) {
+	src := filepath.Join(root.dir, "src")
+	// the root is private, so nobody else can create the src directory
+	if err := os.Mkdir(src, 0700); err != nil {
+		return nil, errors.Wrap(err, "unable to create source root")
+	}
+	remove := func() {
+		_ = os.RemoveAll(src)
+	}
+	for importPath, files := range sp {
+		dir := filepath.Join(src, filepath.FromSlash(importPath))
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			remove()
+			return nil, errors.Wrapf(err, "unable to create directory for %q", importPath)
+		}
+		for name, code := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(code), 0600); err != nil {
+				remove()
+				return nil, errors.Wrapf(err, "unable to write %q in %q", name, importPath)
+			}
+		}
+	}
+	if goPath != "" {
+		if err := linkTree(filepath.Join(goPath, "src"), src); err != nil {
+			remove()
+			return nil, err
+		}
+	}
+	return remove, nil
+}
+
+// linkTree links all entries of src into dst, directories that exist in both trees are merged.
+func linkTree(src, dst string) error {
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "unable to read %q", src)
+	}
+	for _, entry := range entries {
+		srcPath := filepath.Join(src, entry.Name())
+		dstPath := filepath.Join(dst, entry.Name())
+		info, err := os.Stat(dstPath)
+		if os.IsNotExist(err) {
+			if err := os.Symlink(srcPath, dstPath); err != nil {
+				return errors.Wrapf(err, "unable to link %q", srcPath)
+			}
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "unable to stat %q", dstPath)
+		}
+		if info.IsDir() && entry.IsDir() {
+			if err := linkTree(srcPath, dstPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
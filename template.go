@@ -47,6 +47,7 @@ import (
 	"bufio"
 	"io"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 
@@ -61,6 +62,7 @@ import (
 	"fmt"
 
 	"sync"
+	"time"
 
 	"go/parser"
 	"go/scanner"
@@ -71,6 +73,7 @@ import (
 	"github.com/traefik/yaegi/interp"
 
 	"github.com/Eun/yaegi-template/codebuffer"
+	"github.com/Eun/yaegi-template/helpers"
 )
 
 // Template represents a template.
@@ -81,9 +84,49 @@ type Template struct {
 	templateReader io.Reader
 	StartTokens    []rune
 	EndTokens      []rune
+	// Escaper escapes the output of the code blocks, see NewEscaper() and EscaperForFile().
+	// It must be set before parsing.
+	Escaper Escaper
+	// AutoIndent indents multi-line output of expression blocks (and blocks with a single statement, e.g. a print)
+	// to the column of the block. It must be set before parsing.
+	AutoIndent bool
+	// GoOutput formats the output as go source, imports of standard packages are added or removed as needed.
+	// Syntax errors in the output are reported with the line of the output and the position in the template.
+	GoOutput bool
+	// FrontMatter enables the front matter, a YAML or JSON header at the top of the template, see Meta().
+	// It must be set before parsing.
+	FrontMatter bool
+	// Policy filters the symbols that are passed to New() or Use(), see SafePolicy().
+	// It must be set before parsing, the internal functions of the template are not filtered.
+	Policy *Policy
+	// Name identifies the template in import requests and the import audit log.
+	Name string
+	// ImportHook is called for every import, it can approve, rewrite or deny the import.
+	ImportHook ImportHook
+	// GoroutinePanicHandler is called with the panics of goroutines, that were started by the template and panicked
+	// after the execution finished. Panics during the execution are returned by Exec().
+	// If it is nil, the panic gets written to the Stderr of the interpreter options.
+	GoroutinePanicHandler func(*PanicError)
+	// Tracer is called at the start and the end of the execution and of every code block, see NewChromeTracer().
+	// Macros and the files of ExecFiles have no events of their own, see Tracer.
+	Tracer Tracer
+	// ImportAudit is called for every import with the outcome of the import hook, see JSONAuditLog().
+	ImportAudit    func(ImportAuditEntry)
 	interp         *interp.Interpreter
 	outputBuffer   *outputBuffer
 	codeBuffer     *codebuffer.CodeBuffer
+	meta           map[string]interface{}
+	prelude        []string
+	sourcePackages sourcePackages
+	sourceRoot     *sourceRoot
+	formatters     *formatters
+	filters        filters
+	outputFilters  []func(io.Writer) io.Writer
+	egress         *egress
+	env            *environment
+	stderr         *panicWriter
+	goroutines     *goroutines
+	blocks         *blockTracer
 	mu             sync.Mutex
 }
 
@@ -99,8 +142,11 @@ func DefaultOptions() interp.Options {
 }
 
 // DefaultSymbols return the default symbols for the New and MustNew functions.
+// Besides the standard library the helpers package is available, it can be imported with
+//    import "yaegi-template/helpers"
+// DefaultSymbols expose the whole standard library, use SafeSymbols() for templates of untrusted authors.
 func DefaultSymbols() []interp.Exports {
-	return []interp.Exports{stdlib.Symbols}
+	return []interp.Exports{stdlib.Symbols, helpers.Symbols}
 }
 
 // New creates a new Template that can be used in a later time.
@@ -112,6 +158,8 @@ func New(
 		use:         mergeExports(use...),
 		StartTokens: []rune("<$"),
 		EndTokens:   []rune("$>"),
+		formatters:  newFormatters(),
+		filters:     defaultFilters(),
 	}
 	return t, nil
 }
@@ -136,15 +184,9 @@ func (t *Template) Parse(reader io.Reader) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	it, err := t.codeBuffer.Iterator()
-	if err != nil {
-		return err
-	}
-
 	// parse everything now
-	for it.Next() {
-	}
-	return it.Error()
+	var prog program
+	return t.compile(&prog)
 }
 
 // MustParse is like Parse, except it panics on failure.
@@ -162,25 +204,65 @@ func (t *Template) LazyParse(reader io.Reader) error {
 	// maybe in the future we parse the template here
 	// for now we don't
 	t.templateReader = reader
+	t.meta = nil
 
 	t.outputBuffer = newOutputBuffer(true)
+	t.outputBuffer.formatters = t.formatters
 	t.codeBuffer = codebuffer.New(reader, t.StartTokens, t.EndTokens)
 	t.options.Stdout = t.outputBuffer
 
-	t.interp = interp.New(t.options)
+	options := t.options
+	// the interpreter writes the positions of panics to stderr, they become part of the PanicError
+	t.stderr = newPanicWriter(options.Stderr)
+	options.Stderr = t.stderr
+	t.goroutines = &goroutines{stderr: t.stderr.w}
+	t.blocks = &blockTracer{current: -1}
+	if options.Stdin == nil && !t.Policy.Allowed("fmt", "Scan") {
+		// the interpreter replaces the Scan functions of fmt with functions that read from Stdin
+		options.Stdin = strings.NewReader("")
+	}
+	t.sourceRoot = nil
+	if len(t.sourcePackages) != 0 {
+		root, err := newSourceRoot()
+		if err != nil {
+			return err
+		}
+		// the source packages are written into the root during imports, see evalImportBlock
+		t.sourceRoot = root
+		options.GoPath = root.dir
+	}
+
+	t.interp = interp.New(options)
 
 	// if we already have some uses
 	// use them
-	if len(t.use) != 0 {
-		if err := t.interp.Use(t.use); err != nil {
+	if use := t.exports(); len(use) != 0 {
+		if err := t.interp.Use(use); err != nil {
 			return errors.Wrap(err, "unable to use")
 		}
 	}
 
+	if err := t.useInternals(); err != nil {
+		return err
+	}
+
 	// if we already have some imports
 	// import them
 	if len(t.imports) != 0 {
-		if _, err := t.safeEval(t.imports.ImportBlock()); err != nil {
+		imports, err := t.checkImports(t.imports, ImportFromParse, nil)
+		if err != nil {
+			return err
+		}
+		if err := t.evalImportBlock(imports); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < len(t.prelude); i++ {
+		if err := t.evalPrelude(i, t.prelude[i]); err != nil {
+			// the template must not be executed without the prelude
+			t.interp = nil
+			t.codeBuffer = nil
 			return err
 		}
 	}
@@ -188,6 +270,66 @@ func (t *Template) LazyParse(reader io.Reader) error {
 	return nil
 }
 
+// useInternals makes the internal functions, that are used by the assembled program, available in the interpreter.
+func (t *Template) useInternals() error {
+	err := t.interp.Use(interp.Exports{
+		"internal/internal": t.filters.exports(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to use filters")
+	}
+	err = t.interp.Use(interp.Exports{
+		"internal/internal": t.internals(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to use internals")
+	}
+	_, err = t.safeEval(`import . "internal"`)
+	return err
+}
+
+// internals returns the internal functions, that are used by the assembled program.
+func (t *Template) internals() map[string]reflect.Value {
+	ob := t.outputBuffer
+	return map[string]reflect.Value{
+		"__text": reflect.ValueOf(func(part int, s string) {
+			_, _ = ob.WriteText(part, []byte(s))
+		}),
+		"__print": reflect.ValueOf(func(v interface{}) {
+			_, _ = ob.WriteValue(reflect.ValueOf(v))
+		}),
+		"raw": reflect.ValueOf(raw),
+		"__indent": reflect.ValueOf(func(indent string) {
+			ob.SetIndent(indent)
+		}),
+		"indent": reflect.ValueOf(helpers.Indent),
+		"capture": reflect.ValueOf(func(fn func()) string {
+			ob.StartCapture()
+			fn()
+			return ob.EndCapture()
+		}),
+		"section": reflect.ValueOf(func(name string) {
+			if err := ob.SetSection(name); err != nil {
+				panic(err)
+			}
+		}),
+		"yield": reflect.ValueOf(ob.Section),
+		"file": reflect.ValueOf(func(name string) {
+			if err := ob.SetFile(name); err != nil {
+				panic(err)
+			}
+		}),
+		// yaegi does not support conversions to dot imported binary types, so SafeHTML is a function
+		"SafeHTML": reflect.ValueOf(func(s string) SafeHTML {
+			return SafeHTML(s)
+		}),
+		// go statements are rewritten to __go, so panics of goroutines get recovered
+		"__go": reflect.ValueOf(t.goroutines.start),
+		// code blocks report their start with __block, if a Tracer is set
+		"__block": reflect.ValueOf(t.blocks.block),
+	}
+}
+
 // MustLazyParse is like LazyParse, except it panics on failure.
 func (t *Template) MustLazyParse(r io.Reader) *Template {
 	if err := t.LazyParse(r); err != nil {
@@ -224,61 +366,111 @@ func (t *Template) MustParseBytes(b []byte) error {
 
 // Exec executes the template, and writes the output to the specified writer.
 func (t *Template) Exec(writer io.Writer, context interface{}) (int, error) {
+	return t.exec(writer, context, nil)
+}
+
+// ExecSections is like Exec, but also returns the output of the sections.
+// Inside the template section() switches the output to a named section, section("") switches back to the main output.
+// yield() returns the output of a section that was written so far:
+//    <$ capture body $><$ section("head") $><script src="app.js"></script><$ section("") $><p>Hello</p><$ end $>
+//    <html><head><$= raw(yield("head")) $></head><body><$= raw(body) $></body></html>
+func (t *Template) ExecSections(writer io.Writer, context interface{}) (int, map[string][]byte, error) {
+	var sections map[string][]byte
+	n, err := t.exec(writer, context, &sections)
+	if err != nil {
+		return n, nil, err
+	}
+	return n, sections, nil
+}
+
+// MustExecSections is like ExecSections, except it panics on failure.
+func (t *Template) MustExecSections(writer io.Writer, context interface{}) map[string][]byte {
+	_, sections, err := t.ExecSections(writer, context)
+	if err != nil {
+		panic(err.Error())
+	}
+	return sections
+}
+
+// exec executes the template and writes the main output to the writer, if sections is not nil the output of the
+// sections is stored in it.
+func (t *Template) exec(writer io.Writer, context interface{}, sections *map[string][]byte) (n int, err error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	if t.codeBuffer == nil {
 		return 0, errors.New("template was never parsed")
 	}
 
-	it, err := t.codeBuffer.Iterator()
-	if err != nil {
+	end := t.traceExecution()
+	defer func() {
+		end(err)
+	}()
+
+	var prog program
+	if err := t.compile(&prog); err != nil {
 		return 0, err
 	}
 
-	var buf bytes.Buffer
+	t.outputBuffer.allowFiles = false
+	return t.execCode(&prog, context, func() (int, error) {
+		output := t.outputBuffer.Bytes()
+		if t.GoOutput {
+			var err error
+			output, err = formatGoOutput(&prog, t.outputBuffer.segments, output)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if sections != nil {
+			*sections = t.outputBuffer.Sections()
+		}
+		if writer == nil {
+			return 0, nil
+		}
+		return t.writeOutput(writer, output)
+	})
+}
+
+// compile walks trough all parts of the template and assembles them into the program.
+func (t *Template) compile(prog *program) error {
+	it, err := t.codeBuffer.Iterator()
+	if err != nil {
+		return err
+	}
 
+	prog.trackText = t.Escaper != nil || t.AutoIndent || t.GoOutput
+	prog.autoIndent = t.AutoIndent
+	prog.frontMatter = t.FrontMatter
+	prog.filters = t.filters
+	prog.trace = t.Tracer != nil && prog.constantPrefix == ""
 	for it.Next() {
-		part := it.Value()
-		switch part.Type {
-		case codebuffer.CodePartType:
-			if _, err := buf.Write(part.Content); err != nil {
-				return 0, errors.Wrap(err, "unable to write code part")
-			}
-			if _, err := buf.WriteRune('\n'); err != nil {
-				return 0, errors.Wrap(err, "unable to write code part")
-			}
-		case codebuffer.TextPartType:
-			if _, err := buf.WriteString("print("); err != nil {
-				return 0, errors.Wrap(err, "unable to write text part")
-			}
-			if _, err := buf.WriteString(strconv.Quote(string(part.Content))); err != nil {
-				return 0, errors.Wrap(err, "unable to write text part")
-			}
-			if _, err := buf.WriteString(")\n"); err != nil {
-				return 0, errors.Wrap(err, "unable to write text part")
-			}
+		if err := prog.addPart(it.Value()); err != nil {
+			return err
 		}
 	}
 	if err := it.Error(); err != nil {
-		return 0, err
+		return err
 	}
-
-	n, err := t.execCode(buf.String(), writer, context)
-	if err != nil {
-		var errWriter strings.Builder
-		scnr := bufio.NewScanner(&buf)
-		i := 1
-		for scnr.Scan() {
-			fmt.Fprintf(&errWriter, "%d\t%s\n", i, scnr.Text())
-			i++
-		}
-		if err := scnr.Err(); err != nil {
-			return 0, errors.Wrap(err, "unable to scan source")
-		}
-
-		return 0, errors.Wrapf(err, "error during execution of\n%s", errWriter.String())
+	if err := prog.finish(); err != nil {
+		return err
 	}
-	return n, nil
+	t.meta = prog.meta
+	return nil
+}
+
+// Meta returns the front matter of the template.
+// If FrontMatter is set, the template can start with a YAML or JSON header, fenced by "---" lines:
+//    ---
+//    title: Hello World
+//    ---
+//    <h1><$ print(meta["title"]) $></h1>
+// Meta returns nil if the template has no front matter, FrontMatter is not set or the template was not parsed yet.
+// Note that LazyParse parses the front matter during the first call to Exec().
+// Inside the code blocks the front matter can be accessed by using the meta identifier.
+func (t *Template) Meta() map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.meta
 }
 
 // MustExec is like Exec, except it panics on failure.
@@ -288,16 +480,23 @@ func (t *Template) MustExec(writer io.Writer, context interface{}) {
 	}
 }
 
-func (t *Template) execCode(code string, out io.Writer, context interface{}) (int, error) {
-	if err := t.evalImports(&code); err != nil {
-		return 0, err
+// execCode executes the program, emit is called with the rendered output in the output buffer.
+func (t *Template) execCode(prog *program, context interface{}, emit func() (int, error)) (int, error) {
+	code := prog.code.String()
+	if err := t.evalImports(&code, ImportFromTemplate, importPosition(prog.sources)); err != nil {
+		return 0, wrapSourceError(err, "execution of", prog.code.String())
 	}
+	internalSymbols := make(map[string]reflect.Value)
 	if context != nil {
+		internalSymbols["context"] = reflect.ValueOf(context)
+	}
+	if prog.meta != nil {
+		internalSymbols["meta"] = reflect.ValueOf(prog.meta)
+	}
+	if len(internalSymbols) != 0 {
 		// do we need to
 		err := t.interp.Use(interp.Exports{
-			"internal/internal": map[string]reflect.Value{
-				"context": reflect.ValueOf(context),
-			},
+			"internal/internal": internalSymbols,
 		})
 		if err != nil {
 			return 0, errors.Wrapf(err, "unable to use context")
@@ -309,24 +508,91 @@ func (t *Template) execCode(code string, out io.Writer, context interface{}) (in
 		}
 	}
 
-	// make sure the buffer is empty
+	// declare the macros after the context is available, so they can use it
+	// the macros start after the lines of the code, so the positions of panics can be told apart
+	codeLines := strings.Count(code, "\n") + 1
+	if _, err := t.safeEval(strings.Repeat("\n", codeLines) + prog.macros.String()); err != nil {
+		return 0, wrapSourceErrorAt(err, "execution of", prog.macros.String(), codeLines+1)
+	}
+
+	if t.egress != nil {
+		// the request limit applies to every execution
+		t.egress.reset()
+	}
+	if t.env != nil {
+		// changes of the environment only last for one execution
+		t.env.reset()
+	}
+
+	// make sure the buffer is empty and the escaper starts in its initial context
+	t.outputBuffer.SetEscaper(t.Escaper)
+	t.outputBuffer.SetIndent("")
+	t.outputBuffer.trackSegments = t.GoOutput
 	t.outputBuffer.DiscardWrites(false)
+	defer func() {
+		t.outputBuffer.DiscardWrites(true)
+		t.outputBuffer.Reset()
+	}()
+	t.goroutines.begin(t.GoroutinePanicHandler)
+	if prog.trace {
+		t.blocks.begin(t.Tracer, t.Name, prog.sources)
+	}
 	res, err := t.safeEval(code)
+	t.blocks.end()
+	if goErr := t.goroutines.end(); err == nil && goErr != nil {
+		err = goErr
+	}
 	if err != nil {
-		return 0, err
+		if panicErr, ok := err.(*PanicError); ok {
+			panicErr.locate(prog, code, codeLines)
+		}
+		return 0, wrapSourceError(err, "execution of", prog.code.String())
 	}
 
 	if t.outputBuffer.Length() == 0 {
 		// implicit write
-		fmt.Fprint(t.outputBuffer, printValue(res))
+		if _, err := t.outputBuffer.WriteResult(res); err != nil {
+			return 0, err
+		}
+	}
+	return emit()
+}
+
+// traceExecution reports the start of an execution to the Tracer, the returned function reports its end.
+func (t *Template) traceExecution() func(err error) {
+	tracer := t.Tracer
+	if tracer == nil {
+		return func(error) {}
 	}
-	var n int
-	if out != nil {
-		n, err = out.Write(t.outputBuffer.Bytes())
+	start := time.Now()
+	tracer.TemplateStart(t.Name)
+	return func(err error) {
+		if err != nil {
+			tracer.Error(t.Name, err)
+		}
+		tracer.TemplateEnd(t.Name, time.Since(start))
 	}
-	t.outputBuffer.DiscardWrites(true)
-	t.outputBuffer.Reset()
-	return n, err
+}
+
+// wrapSourceError wraps the error with a numbered listing of the code that caused it.
+func wrapSourceError(err error, stage, code string) error {
+	return wrapSourceErrorAt(err, stage, code, 1)
+}
+
+// wrapSourceErrorAt is like wrapSourceError, the listing starts at firstLine.
+func wrapSourceErrorAt(err error, stage, code string, firstLine int) error {
+	var errWriter strings.Builder
+	scnr := bufio.NewScanner(strings.NewReader(code))
+	i := firstLine
+	for scnr.Scan() {
+		fmt.Fprintf(&errWriter, "%d\t%s\n", i, scnr.Text())
+		i++
+	}
+	if err := scnr.Err(); err != nil {
+		return errors.Wrap(err, "unable to scan source")
+	}
+
+	return errors.Wrapf(err, "error during %s\n%s", stage, errWriter.String())
 }
 
 func (t *Template) safeEval(code string) (res reflect.Value, err error) {
@@ -334,60 +600,57 @@ func (t *Template) safeEval(code string) (res reflect.Value, err error) {
 		return reflect.Value{}, nil
 	}
 
+	// drop the positions of earlier panics (e.g. of goroutines)
+	t.stderr.take()
 	defer func() {
 		e := recover()
 		if e == nil {
 			return
 		}
-		switch v := e.(type) {
-		case error:
-			err = v
-		default:
-			err = fmt.Errorf("%v", v)
-		}
+		err = newPanicError(e, t.stderr.take())
 	}()
 
 	res, err = t.interp.Eval(code)
-	if err != nil {
-		return res, err
+	if p, ok := err.(interp.Panic); ok {
+		return res, newPanicError(p, t.stderr.take())
 	}
 	return res, err
 }
 
-func printValue(v reflect.Value) string {
-	if !v.IsValid() || !v.CanInterface() {
-		return ""
+// evalImports finds all "import" lines evaluates them and removes them from the code.
+// position returns the position of an import in the template, it can be nil.
+func (t *Template) evalImports(code *string, origin ImportOrigin, position func(Import) (int, int)) error {
+	syms, c, err := t.extractImports(*code)
+	if err != nil {
+		return err
 	}
-
-	switch x := v.Interface().(type) {
-	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
-		return fmt.Sprint(x)
-	case string:
-		return x
-	default:
-		return ""
+	if err := t.importSymbols(syms, origin, position); err != nil {
+		return err
 	}
+	*code = c
+	return nil
 }
 
-// evalImports finds all "import" lines evaluates them and removes them from the code.
-func (t *Template) evalImports(code *string) error {
+// extractImports finds all "import" lines and returns them, alongside with the code without the "import" lines.
+func (t *Template) extractImports(code string) (importSymbols, string, error) {
 	var ok bool
-	ok, err := t.hasPackage(*code)
+	ok, err := t.hasPackage(code)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 	var c string
 	if !ok {
-		c = "package main\n" + *code
+		c = "package main\n" + code
 	} else {
-		c = *code
+		c = code
 	}
 	fset := token.NewFileSet()
 	f, err := parser.ParseFile(fset, "", c, parser.ImportsOnly)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 
+	var syms importSymbols
 	for _, decl := range f.Decls {
 		genDecl, ok := decl.(*ast.GenDecl)
 		if !ok {
@@ -397,7 +660,6 @@ func (t *Template) evalImports(code *string) error {
 			continue
 		}
 
-		syms := make(importSymbols, 0, len(genDecl.Specs))
 		for _, spec := range genDecl.Specs {
 			importSpec, ok := spec.(*ast.ImportSpec)
 			if !ok {
@@ -418,19 +680,13 @@ func (t *Template) evalImports(code *string) error {
 			syms = append(syms, sym)
 		}
 
-		if err := t.Import(syms...); err != nil {
-			return err
-		}
-
 		pos := int(genDecl.Pos()) - 1
 		end := int(genDecl.End()) - 1
 		c = c[:pos] + strings.Repeat(" ", end-pos) + c[end:]
 	}
 
 	// remove package main\n
-	*code = c[f.Name.End():]
-
-	return nil
+	return syms, c[f.Name.End():], nil
 }
 
 // hasPackage returns true when the code has a 'package' line.
@@ -454,6 +710,10 @@ func (*Template) hasPackage(s string) (bool, error) {
 
 // Import imports the specified imports to the interpreter.
 func (t *Template) Import(imports ...Import) error {
+	return t.importSymbols(imports, ImportFromCall, nil)
+}
+
+func (t *Template) importSymbols(imports importSymbols, origin ImportOrigin, position func(Import) (int, int)) error {
 	var symbolsToImport importSymbols
 	for _, symbol := range imports {
 		if !t.imports.Contains(symbol) {
@@ -466,7 +726,11 @@ func (t *Template) Import(imports ...Import) error {
 	}
 
 	if t.interp != nil { // if we have an interpreter, import right now
-		if _, err := t.safeEval(symbolsToImport.ImportBlock()); err != nil {
+		checked, err := t.checkImports(symbolsToImport, origin, position)
+		if err != nil {
+			return err
+		}
+		if err := t.evalImportBlock(checked); err != nil {
 			return err
 		}
 	}
@@ -474,6 +738,33 @@ func (t *Template) Import(imports ...Import) error {
 	return nil
 }
 
+// evalImportBlock evaluates the imports, the source packages are available during the evaluation.
+func (t *Template) evalImportBlock(imports importSymbols) error {
+	if t.sourceRoot != nil && t.importsFromDisk(imports) {
+		remove, err := t.sourceRoot.write(t.sourcePackages, t.options.GoPath)
+		if err != nil {
+			return err
+		}
+		defer remove()
+	}
+	_, err := t.safeEval(imports.ImportBlock())
+	return err
+}
+
+// importsFromDisk returns true if one of the imports is not a binary package, so it is loaded from the GOPATH.
+func (t *Template) importsFromDisk(imports importSymbols) bool {
+	binary := make(map[string]bool)
+	for key := range t.exports() {
+		binary[path.Dir(key)] = true
+	}
+	for _, symbol := range imports {
+		if !binary[symbol.Path] {
+			return true
+		}
+	}
+	return false
+}
+
 // MustImport is like Import, except it panics on failure.
 func (t *Template) MustImport(imports ...Import) *Template {
 	if err := t.Import(imports...); err != nil {
@@ -482,6 +773,102 @@ func (t *Template) MustImport(imports ...Import) *Template {
 	return t
 }
 
+// Prelude adds go code (helper functions, constants, types) that is evaluated once into the interpreter,
+// before the template body gets executed.
+// Declarations of the prelude can be used in all code blocks of the template:
+//    template.MustPrelude(`func Greet(name string) string { return "Hello " + name }`)
+//    template.MustParseString(`<$ print(Greet("Joe")) $>`)
+// Note that the prelude is evaluated before the context is available.
+// Errors and panics report the positions of the prelude as prelude.go (prelude2.go for the second prelude, ...).
+// If the template was already parsed, a prelude that fails to evaluate is not added. Otherwise the prelude is
+// evaluated during parsing and every parse fails until the template is replaced by one with a working prelude.
+func (t *Template) Prelude(code string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// if we have an interpreter, evaluate right now
+	if t.interp != nil {
+		if err := t.evalPrelude(len(t.prelude), code); err != nil {
+			return err
+		}
+	}
+	t.prelude = append(t.prelude, code)
+	return nil
+}
+
+// preludeFileName returns the file name that is used for the positions of the prelude with the index i.
+func preludeFileName(i int) string {
+	if i == 0 {
+		return "prelude.go"
+	}
+	return "prelude" + strconv.Itoa(i+1) + ".go"
+}
+
+// MustPrelude is like Prelude, except it panics on failure.
+func (t *Template) MustPrelude(code string) *Template {
+	if err := t.Prelude(code); err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// evalPrelude evaluates the prelude with the index i.
+func (t *Template) evalPrelude(i int, code string) error {
+	src := code
+	if err := t.evalImports(&src, ImportFromPrelude, nil); err != nil {
+		return wrapSourceError(err, "evaluation of prelude", code)
+	}
+	if strings.TrimSpace(src) == "" {
+		return nil
+	}
+	// the line directive makes the interpreter report the positions in the prelude
+	if _, err := t.safeEval("/*line " + preludeFileName(i) + ":1:1*/" + src); err != nil {
+		return wrapSourceError(err, "evaluation of prelude", code)
+	}
+	return nil
+}
+
+// exports returns the symbols that are passed to the interpreter, restricted by the egress policy, the virtual
+// environment and the Policy.
+func (t *Template) exports() interp.Exports {
+	unfiltered := t.unfilteredExports()
+	exports := t.Policy.Filter(unfiltered)
+	if t.Policy == nil {
+		return exports
+	}
+	// the symbols of a sandbox only give access to the sandbox, they are not restricted by Allow, but by Deny
+	for _, key := range sandboxedPackages {
+		if !isSandboxPackage(key, unfiltered[key]) {
+			continue
+		}
+		for name, value := range unfiltered[key] {
+			if _, ok := exports[key][name]; ok {
+				continue
+			}
+			if !isSandboxSymbol(key, name, value) || t.Policy.denied(path.Dir(key), name) {
+				continue
+			}
+			if exports[key] == nil {
+				exports[key] = make(map[string]reflect.Value)
+			}
+			exports[key][name] = value
+		}
+	}
+	return exports
+}
+
+// unfilteredExports returns the symbols restricted by the egress policy and the virtual environment, but not by the
+// Policy.
+func (t *Template) unfilteredExports() interp.Exports {
+	use := t.use
+	if t.egress != nil {
+		use = t.egress.replace(use)
+	}
+	if t.env != nil {
+		use = t.env.replace(use)
+	}
+	return use
+}
+
 // Use loads binary runtime symbols in the interpreter context so
 // they can be used in interpreted code.
 func (t *Template) Use(values ...interp.Exports) error {
@@ -496,7 +883,7 @@ func (t *Template) useExports(values interp.Exports) error {
 	t.use = mergeExports(t.use, values)
 	// if we have an interpreter, use right now
 	if t.interp != nil {
-		if err := t.interp.Use(t.use); err != nil {
+		if err := t.interp.Use(t.exports()); err != nil {
 			return errors.Wrap(err, "unable to use")
 		}
 	}
@@ -1,6 +1,7 @@
 package yaegi_template
 
 import (
+	"errors"
 	"io"
 	"reflect"
 	"testing"
@@ -12,6 +13,7 @@ import (
 
 	"os"
 	"path/filepath"
+	"runtime"
 
 	"io/ioutil"
 
@@ -266,7 +268,7 @@ func TestPanic(t *testing.T) {
 		MustParseString(`<$panic("Oh no")$>`)
 	var buf bytes.Buffer
 	_, err := template.Exec(&buf, nil)
-	require.EqualError(t, err, "error during execution of\n1\tpanic(\"Oh no\")\n: Oh no")
+	require.EqualError(t, err, "error during execution of\n1\tpanic(\"Oh no\")\n: Oh no (template 1:3)")
 }
 
 func TestNoStartOrEnd(t *testing.T) {
@@ -731,3 +733,505 @@ for _, name := range context.Names {
 		require.Equal(t, "<ul><li>Alice</li><li>Joe</li></ul>", buf.String())
 	})
 }
+
+func TestMacro(t *testing.T) {
+	t.Run("simple", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<$ macro Card(title string, body string) $><div><h1><$ print(title) $></h1><p><$ print(body) $></p></div><$ end $>` +
+				`<html><$ Card("Hello", "World") $><$ Card(context.Title, "Yaegi") $></html>`)
+
+		type Context struct {
+			Title string
+		}
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, Context{Title: "Joe"})
+		require.Equal(t, "<html><div><h1>Hello</h1><p>World</p></div><div><h1>Joe</h1><p>Yaegi</p></div></html>", buf.String())
+		buf.Reset()
+		template.MustExec(&buf, Context{Title: "Alice"})
+		require.Equal(t, "<html><div><h1>Hello</h1><p>World</p></div><div><h1>Alice</h1><p>Yaegi</p></div></html>", buf.String())
+	})
+
+	t.Run("call before declaration", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<ul><$ for _, name := range []string{"Alice", "Joe"} { Item(name) } $></ul>
+<$- macro Item(name string) -$>
+<li><$ print(name) $></li>
+<$- end $>`)
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		require.Equal(t, "<ul><li>Alice</li><li>Joe</li></ul>", buf.String())
+	})
+
+	t.Run("macro uses context", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<$ macro Greet() $>Hello <$ print(context["Name"]) $><$ end $><$ Greet() $>`)
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, map[string]interface{}{"Name": "Joe"})
+		require.Equal(t, "Hello Joe", buf.String())
+	})
+
+	t.Run("not closed", func(t *testing.T) {
+		err := MustNew(interp.Options{}, stdlib.Symbols).
+			ParseString(`<$ macro Card() $><div></div>`)
+		require.EqualError(t, err, "macro Card was not closed, missing end")
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		err := MustNew(interp.Options{}, stdlib.Symbols).
+			ParseString(`<$ macro Card() $><$ macro Title() $><$ end $><$ end $>`)
+		require.EqualError(t, err, "unable to declare macro Title inside of macro Card")
+	})
+}
+
+func TestFrontMatter(t *testing.T) {
+	newTemplate := func() *Template {
+		template := MustNew(interp.Options{}, stdlib.Symbols)
+		template.FrontMatter = true
+		return template
+	}
+
+	t.Run("yaml", func(t *testing.T) {
+		template := newTemplate().
+			MustParseString(`---
+title: Hello World
+tags:
+  - yaegi
+  - template
+---
+<h1><$ print(meta["title"]) $></h1>`)
+
+		require.Equal(t, map[string]interface{}{
+			"title": "Hello World",
+			"tags":  []interface{}{"yaegi", "template"},
+		}, template.Meta())
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		require.Equal(t, "<h1>Hello World</h1>", buf.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		template := newTemplate().
+			MustParseString("---\r\n{\"title\": \"Hello World\", \"cache\": 60}\r\n---\r\n<h1><$ print(meta[\"title\"], context.Name) $></h1>")
+
+		require.Equal(t, map[string]interface{}{
+			"title": "Hello World",
+			"cache": 60,
+		}, template.Meta())
+
+		type Context struct {
+			Name string
+		}
+		var buf bytes.Buffer
+		template.MustExec(&buf, Context{Name: "Joe"})
+		require.Equal(t, "<h1>Hello World Joe</h1>", buf.String())
+	})
+
+	t.Run("lazy parse", func(t *testing.T) {
+		template := newTemplate().
+			MustLazyParse(bytes.NewBufferString("---\ntitle: Hello World\n---\n"))
+		require.Nil(t, template.Meta())
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		require.Equal(t, "", buf.String())
+		require.Equal(t, map[string]interface{}{"title": "Hello World"}, template.Meta())
+	})
+
+	t.Run("no front matter", func(t *testing.T) {
+		template := newTemplate().
+			MustParseString("Hello\n---\ntitle: Hello World\n---\n")
+		require.Nil(t, template.Meta())
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		require.Equal(t, "Hello\n---\ntitle: Hello World\n---\n", buf.String())
+	})
+
+	t.Run("not closed", func(t *testing.T) {
+		err := newTemplate().
+			ParseString("---\ntitle: Hello World\n")
+		require.EqualError(t, err, "front matter was not closed, missing ---")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		// yaml documents start with ---, they are no front matter by default
+		for _, content := range []string{
+			"---\nkind: A\n---\nkind: B\n",
+			"---\nkind: A\n",
+		} {
+			template := MustNew(interp.Options{}, stdlib.Symbols).MustParseString(content)
+			require.Nil(t, template.Meta())
+
+			var buf bytes.Buffer
+			template.MustExec(&buf, nil)
+			require.Equal(t, content, buf.String())
+		}
+	})
+}
+
+func TestAddSourcePackage(t *testing.T) {
+	world := map[string]string{
+		"world.go": `package world
+import "strings"
+func World() string {
+    return strings.ToUpper("World")
+}`,
+	}
+
+	t.Run("simple", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustAddSourcePackage("acme/world", world).
+			MustParseString(`<$ import "acme/world" $>Hello <$ print(world.World()) $>`)
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		require.Equal(t, "Hello WORLD", buf.String())
+
+		buf.Reset()
+		template.MustExec(&buf, nil)
+		require.Equal(t, "Hello WORLD", buf.String())
+	})
+
+	t.Run("import before parse", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustAddSourcePackage("acme/world", world).
+			MustImport(Import{Name: "w", Path: "acme/world"}).
+			MustParseString(`Hello <$ print(w.World()) $>`)
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		require.Equal(t, "Hello WORLD", buf.String())
+	})
+
+	t.Run("package imports package", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustAddSourcePackage("acme/world", world).
+			MustAddSourcePackage("acme/greeter", map[string]string{
+				"greeter.go": `package greeter
+import "acme/world"
+func Greet() string {
+    return "Hello " + world.World()
+}`,
+			}).
+			MustParseString(`<$ import "acme/greeter" $><$ print(greeter.Greet()) $>`)
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		require.Equal(t, "Hello WORLD", buf.String())
+	})
+
+	t.Run("with GoPath", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("creating symlinks requires elevated privileges on windows")
+		}
+		tmp, err := ioutil.TempDir("", "")
+		require.NoError(t, err)
+		defer os.RemoveAll(tmp)
+
+		srcPath := filepath.Join(tmp, "src", "acme", "name")
+		require.NoError(t, os.MkdirAll(srcPath, 0777))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(srcPath, "name.go"), []byte(`package name
+func Name() string {
+    return "Joe"
+}`), 0600))
+
+		template := MustNew(interp.Options{GoPath: tmp}, stdlib.Symbols).
+			MustAddSourcePackage("acme/world", world).
+			MustParseString(`<$ import ("acme/world"; "acme/name") $>Hello <$ print(world.World() + " " + name.Name()) $>`)
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		require.Equal(t, "Hello WORLD Joe", buf.String())
+	})
+
+	t.Run("private root", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustAddSourcePackage("acme/world", world).
+			MustParseString(`<$ import "acme/world" $><$ print(world.World()) $>`)
+		template.MustExec(&bytes.Buffer{}, nil)
+
+		info, err := os.Stat(template.sourceRoot.dir)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0700), info.Mode().Perm())
+		// the packages only exist during the evaluation of imports
+		_, err = os.Stat(filepath.Join(template.sourceRoot.dir, "src"))
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols)
+		require.EqualError(t, template.AddSourcePackage("../world", world), `invalid import path "../world"`)
+		require.EqualError(t, template.AddSourcePackage("world", map[string]string{"../world.go": ""}),
+			`invalid file name "../world.go" in source package "world"`)
+		require.EqualError(t, template.AddSourcePackage("world", nil), `source package "world" has no files`)
+
+		template.MustParseString(`Hello`)
+		require.EqualError(t, template.AddSourcePackage("acme/world", world), "source packages must be added before the template gets parsed")
+	})
+}
+
+func TestPrelude(t *testing.T) {
+	t.Run("simple", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustPrelude(`import "strings"
+const Greeting = "Hello"
+func Greet(name string) string {
+	return Greeting + " " + strings.ToUpper(name)
+}`).
+			MustParseString(`<p><$ print(Greet(context.Name)) $></p>`)
+
+		type Context struct {
+			Name string
+		}
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, Context{Name: "Joe"})
+		require.Equal(t, "<p>Hello JOE</p>", buf.String())
+		buf.Reset()
+		template.MustExec(&buf, Context{Name: "Alice"})
+		require.Equal(t, "<p>Hello ALICE</p>", buf.String())
+	})
+
+	t.Run("after parse", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<p><$ print(Greet()) $></p>`).
+			MustPrelude(`func Greet() string { return "Hello" }`)
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		require.Equal(t, "<p>Hello</p>", buf.String())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustPrelude(`func Greet() string {
+	return Hello
+}`)
+		err := template.ParseString(`<p><$ print(Greet()) $></p>`)
+		require.EqualError(t, err, "error during evaluation of prelude\n1\tfunc Greet() string {\n2\t\treturn Hello\n3\t}\n: prelude.go:2:9: undefined: Hello")
+
+		// the failed prelude is kept, the template can not be used without it
+		err2 := template.ParseString(`<p>Hello</p>`)
+		require.Error(t, err2)
+		require.Equal(t, err.Error(), err2.Error())
+		_, err = template.Exec(&bytes.Buffer{}, nil)
+		require.EqualError(t, err, "template was never parsed")
+
+		// a prelude added after parsing is evaluated at once, it is not added if it fails
+		template = MustNew(interp.Options{}, stdlib.Symbols).MustParseString(`<p>Hello</p>`)
+		err = template.Prelude(`var x = "a" + 1`)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "prelude.go:1:")
+		template.MustPrelude(`func Greet() string { return "Hello" }`).
+			MustParseString(`<p><$ print(Greet()) $></p>`)
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		require.Equal(t, "<p>Hello</p>", buf.String())
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustPrelude(`func Helper() {}`).
+			MustPrelude(`func Boom() {
+	panic("boom")
+}`).
+			MustParseString("Hello\n<$ Boom() $>")
+		_, err := template.Exec(&bytes.Buffer{}, nil)
+		var panicErr *PanicError
+		require.True(t, errors.As(err, &panicErr))
+		require.Equal(t, []PanicFrame{{File: "prelude2.go", Line: 2, Column: 2}, {Line: 2, Column: 4}}, panicErr.Frames)
+		require.Equal(t, 2, panicErr.Line)
+		require.Equal(t, 4, panicErr.Column)
+	})
+}
+
+func TestExpression(t *testing.T) {
+	t.Run("simple", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<p><$= context.Name $> is <$=context.Age$></p><$= func() {} $>`)
+
+		type Context struct {
+			Name string
+			Age  int
+		}
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, Context{Name: "<Joe>", Age: 42})
+		require.Equal(t, "<p><Joe> is 42</p>", buf.String())
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		err := MustNew(interp.Options{}, stdlib.Symbols).ParseString(`<p><$= $></p>`)
+		require.EqualError(t, err, "expression block is empty")
+	})
+}
+
+func TestHelpers(t *testing.T) {
+	template := MustNew(interp.Options{}, DefaultSymbols()...).
+		MustParseString(`<$ import "yaegi-template/helpers" $><$= helpers.ByteSize(context.Size) $> <$= helpers.Default(context.Name, "guest") $>`)
+
+	type Context struct {
+		Size int64
+		Name string
+	}
+
+	var buf bytes.Buffer
+	template.MustExec(&buf, Context{Size: 1536})
+	require.Equal(t, "1.5 KiB guest", buf.String())
+}
+
+func TestCollectionHelpers(t *testing.T) {
+	template := MustNew(interp.Options{}, DefaultSymbols()...).
+		MustParseString(`<$ import "yaegi-template/helpers" -$>
+<$ for _, group := range helpers.GroupBy(context, "City") { -$>
+<$= group.Key $>:<$ for _, item := range helpers.Range(group.Items) { $><$ if !item.First { $>,<$ } $><$= item.Value.(map[string]interface{})["Name"] $><$ } $>;
+<$- } -$>
+<$= len(helpers.Filter(context, func(p map[string]interface{}) bool { return p["Age"].(int) > 30 }).([]map[string]interface{})) $>`)
+
+	var buf bytes.Buffer
+	template.MustExec(&buf, []map[string]interface{}{
+		{"Name": "Joe", "Age": 42, "City": "Berlin"},
+		{"Name": "Alice", "Age": 23, "City": "Paris"},
+		{"Name": "Bob", "Age": 31, "City": "Berlin"},
+	})
+	require.Equal(t, "Berlin:Joe,Bob;Paris:Alice;2", buf.String())
+}
+
+func TestAutoIndent(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Template string
+		Expect   string
+	}{
+		{
+			"Expression",
+			"spec:\n  containers:\n    <$= context $>\n",
+			"spec:\n  containers:\n    - name: app\n      image: nginx\n\n      ports: [80]\n",
+		},
+		{
+			"Column",
+			"key: <$= context $>\n",
+			"key: - name: app\n       image: nginx\n\n       ports: [80]\n",
+		},
+		{
+			"Tabs",
+			"func main() {\n\t<$ print(\"a()\\nb()\") $>\n}",
+			"func main() {\n\ta()\n\tb()\n}",
+		},
+		{
+			"Statement block",
+			"<$ lines := []string{\"a\", \"b\"} $>  <$ for _, l := range lines { $><$= l + \"\\n\" $><$ } $>",
+			"  a\n  b\n",
+		},
+		{
+			"indent",
+			"items:\n<$= indent(2, context) $>",
+			"items:\n  - name: app\n    image: nginx\n\n    ports: [80]",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			template := MustNew(interp.Options{}, stdlib.Symbols)
+			template.AutoIndent = true
+			template.MustParseString(test.Template)
+
+			var buf bytes.Buffer
+			template.MustExec(&buf, "- name: app\n  image: nginx\n\n  ports: [80]")
+			require.Equal(t, test.Expect, buf.String())
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString("  <$= context $>")
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, "a\nb")
+		require.Equal(t, "  a\nb", buf.String())
+	})
+}
+
+func TestCapture(t *testing.T) {
+	t.Run("block", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<$ import "strings" $><$ capture title $>Hello <$= context $><$ end $>` +
+				`<h1><$= strings.ToUpper(title) $></h1><p><$= len(title) $></p>`)
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, "Joe")
+		require.Equal(t, "<h1>HELLO JOE</h1><p>9</p>", buf.String())
+	})
+
+	t.Run("function", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<$ s := capture(func() { $>a<$ print("b") $><$ }) $>[<$= s + s $>]`)
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, nil)
+		require.Equal(t, "[abab]", buf.String())
+	})
+
+	t.Run("nested in macro", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<$ macro Layout(body string) $><main><$= raw(body) $></main><$ end $>` +
+				`<$ capture body $><$ capture inner $><b><$= context $></b><$ end $><p><$= raw(inner) $></p><$ end $>` +
+				`<$ Layout(body) $>`)
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, "Joe")
+		require.Equal(t, "<main><p><b>Joe</b></p></main>", buf.String())
+	})
+
+	t.Run("escaper", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols)
+		template.Escaper = EscaperForFile("index.html")
+		template.MustParseString(`<$ capture body $><b><$= context $></b><$ end $><div><$= body $></div><$= raw(body) $>`)
+
+		var buf bytes.Buffer
+		template.MustExec(&buf, "<i>")
+		require.Equal(t, "<div>&lt;b&gt;&amp;lt;i&amp;gt;&lt;/b&gt;</div><b>&lt;i&gt;</b>", buf.String())
+	})
+
+	t.Run("not closed", func(t *testing.T) {
+		err := MustNew(interp.Options{}, stdlib.Symbols).
+			ParseString(`<$ capture body $><div></div>`)
+		require.EqualError(t, err, "capture body was not closed, missing end")
+	})
+}
+
+func TestSections(t *testing.T) {
+	t.Run("layout", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols)
+		template.Escaper = EscaperForFile("index.html")
+		template.MustParseString(`<$ capture body $><$ section("head") $><script src="<$= context $>.js"></script>` +
+			`<$ section("") $><p><$= context $></p><$ end $>` +
+			`<html><head><$= raw(yield("head")) $></head><body><$= raw(body) $></body></html>`)
+
+		var buf bytes.Buffer
+		sections := template.MustExecSections(&buf, "app")
+		require.Equal(t, `<html><head><script src="app.js"></script></head><body><p>app</p></body></html>`, buf.String())
+		require.Equal(t, map[string][]byte{"head": []byte(`<script src="app.js"></script>`)}, sections)
+	})
+
+	t.Run("host", func(t *testing.T) {
+		template := MustNew(interp.Options{}, stdlib.Symbols).
+			MustParseString(`<$ for _, s := range context { $><$ section("scripts") $><$= s $>;<$ section("") $><$= s $> <$ } $>`)
+
+		var buf bytes.Buffer
+		n, sections, err := template.ExecSections(&buf, []string{"a", "b"})
+		require.NoError(t, err)
+		require.Equal(t, 4, n)
+		require.Equal(t, "a b ", buf.String())
+		require.Equal(t, map[string][]byte{"scripts": []byte("a;b;")}, sections)
+
+		// Exec drops the sections
+		buf.Reset()
+		template.MustExec(&buf, []string{"c"})
+		require.Equal(t, "c ", buf.String())
+	})
+}
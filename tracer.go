@@ -0,0 +1,230 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Eun/yaegi-template/codebuffer"
+)
+
+// Tracer is called during the execution of a template (see Template.Tracer), so the execution can be logged or
+// traced. name is the Name of the template.
+// The code blocks are reported in the order they are executed, a block lasts until the next block starts or the
+// execution ends, so the time of the text between the blocks is part of the block before.
+// There are no events for macros and for the files of ExecFiles. The code blocks of a macro are reported like the
+// other blocks every time the macro is called, from the block of its header (e.g. macro Card(title string)) to its
+// end block, the time after the call until the next block is part of the end block. ExecFiles is traced as one
+// execution, file() only switches the output, so the blocks of all files are reported between TemplateStart and
+// TemplateEnd.
+type Tracer interface {
+	// TemplateStart is called before the template gets executed.
+	TemplateStart(name string)
+	// TemplateEnd is called after the template was executed, duration is the duration of the execution.
+	TemplateEnd(name string, duration time.Duration)
+	// BlockStart is called when a code block starts, part is the code block and its position in the template.
+	BlockStart(name string, part codebuffer.Part)
+	// BlockEnd is called when a code block ends, duration is the duration of the block.
+	BlockEnd(name string, part codebuffer.Part, duration time.Duration)
+	// Error is called if the execution fails, before TemplateEnd.
+	Error(name string, err error)
+}
+
+// blockTracer reports the code blocks of an execution to the Tracer.
+// The code blocks call __block with their index when they start (see program.traceBlock).
+type blockTracer struct {
+	mu      sync.Mutex
+	tracer  Tracer
+	name    string
+	sources []codebuffer.Part
+	// current is the index of the block that is running, -1 if no block is running.
+	current int
+	start   time.Time
+}
+
+// begin is called before the code of the template gets executed.
+func (b *blockTracer) begin(tracer Tracer, name string, sources []codebuffer.Part) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tracer = tracer
+	b.name = name
+	b.sources = sources
+	b.current = -1
+}
+
+// block ends the running block and starts the block with the index part.
+func (b *blockTracer) block(part int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tracer == nil || part < 0 || part >= len(b.sources) {
+		return
+	}
+	b.stop()
+	b.current = part
+	b.start = time.Now()
+	b.tracer.BlockStart(b.name, b.sources[part])
+}
+
+// end ends the running block, it is called after the code of the template was executed.
+func (b *blockTracer) end() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tracer == nil {
+		return
+	}
+	b.stop()
+	// goroutines that are still running must not report their blocks
+	b.tracer = nil
+	b.sources = nil
+}
+
+func (b *blockTracer) stop() {
+	if b.current < 0 {
+		return
+	}
+	b.tracer.BlockEnd(b.name, b.sources[b.current], time.Since(b.start))
+	b.current = -1
+}
+
+// tracedAfter returns true if the start of the code block must be traced after the code of the block, because the
+// code continues a statement (e.g. } else {, case 1:).
+func tracedAfter(code []byte) bool {
+	if macroHeaderRegexp.Match(code) {
+		return true
+	}
+	if bytes.HasPrefix(code, []byte("}")) {
+		return len(bytes.TrimSpace(code[1:])) > 0
+	}
+	for _, keyword := range []string{"case", "default"} {
+		if bytes.HasPrefix(code, []byte(keyword)) {
+			rest := code[len(keyword):]
+			r, _ := utf8.DecodeRune(rest)
+			return len(rest) == 0 || r == ' ' || r == '\t' || r == ':'
+		}
+	}
+	return false
+}
+
+// ChromeTracer is a Tracer that records the executions in the trace event format of Chrome, so the time of the code
+// blocks can be inspected with chrome://tracing or https://ui.perfetto.dev:
+//    tracer := yaegi_template.NewChromeTracer()
+//    template.Tracer = tracer
+//    template.MustExec(w, nil)
+//    f, _ := os.Create("trace.json")
+//    tracer.WriteTo(f)
+type ChromeTracer struct {
+	mu     sync.Mutex
+	origin time.Time
+	events []chromeEvent
+}
+
+type chromeEvent struct {
+	Name     string                 `json:"name"`
+	Category string                 `json:"cat"`
+	Phase    string                 `json:"ph"`
+	Time     float64                `json:"ts"`
+	Duration float64                `json:"dur,omitempty"`
+	Scope    string                 `json:"s,omitempty"`
+	PID      int                    `json:"pid"`
+	TID      int                    `json:"tid"`
+	Args     map[string]interface{} `json:"args,omitempty"`
+}
+
+// NewChromeTracer creates a ChromeTracer, the timestamps of the events are relative to the creation.
+func NewChromeTracer() *ChromeTracer {
+	return &ChromeTracer{origin: time.Now()}
+}
+
+// TemplateStart implements Tracer, the execution is recorded by TemplateEnd.
+func (*ChromeTracer) TemplateStart(string) {}
+
+// TemplateEnd implements Tracer.
+func (c *ChromeTracer) TemplateEnd(name string, duration time.Duration) {
+	c.complete(name, "template", duration, map[string]interface{}{"template": name})
+}
+
+// BlockStart implements Tracer, the block is recorded by BlockEnd.
+func (*ChromeTracer) BlockStart(string, codebuffer.Part) {}
+
+// BlockEnd implements Tracer.
+func (c *ChromeTracer) BlockEnd(name string, part codebuffer.Part, duration time.Duration) {
+	c.complete(blockName(part), "block", duration, map[string]interface{}{
+		"template": name,
+		"line":     part.Line,
+		"column":   part.Column,
+	})
+}
+
+// Error implements Tracer.
+func (c *ChromeTracer) Error(name string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, chromeEvent{
+		Name:     "error",
+		Category: "error",
+		Phase:    "i",
+		Time:     c.since(time.Now()),
+		Scope:    "t",
+		PID:      1,
+		TID:      1,
+		Args:     map[string]interface{}{"template": name, "error": err.Error()},
+	})
+}
+
+// complete records an event that ended now.
+func (c *ChromeTracer) complete(name, category string, duration time.Duration, args map[string]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, chromeEvent{
+		Name:     name,
+		Category: category,
+		Phase:    "X",
+		Time:     c.since(time.Now().Add(-duration)),
+		Duration: float64(duration.Nanoseconds()) / 1e3,
+		PID:      1,
+		TID:      1,
+		Args:     args,
+	})
+}
+
+// since returns the microseconds between the creation of the tracer and t.
+func (c *ChromeTracer) since(t time.Time) float64 {
+	return float64(t.Sub(c.origin).Nanoseconds()) / 1e3
+}
+
+// WriteTo writes the recorded events as JSON to w.
+func (c *ChromeTracer) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	events := c.events
+	if events == nil {
+		events = []chromeEvent{}
+	}
+	b, err := json.Marshal(struct {
+		TraceEvents     []chromeEvent `json:"traceEvents"`
+		DisplayTimeUnit string        `json:"displayTimeUnit"`
+	}{events, "ms"})
+	c.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// blockName returns the name of a code block for the trace: the position and the first line of the code.
+func blockName(part codebuffer.Part) string {
+	code := strings.TrimSpace(string(part.Content))
+	if i := strings.IndexByte(code, '\n'); i >= 0 {
+		code = strings.TrimSpace(code[:i]) + " …"
+	}
+	const maxLength = 40
+	if utf8.RuneCountInString(code) > maxLength {
+		code = string([]rune(code)[:maxLength]) + "…"
+	}
+	return strconv.Itoa(part.Line) + ":" + strconv.Itoa(part.Column) + " " + code
+}
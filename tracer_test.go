@@ -0,0 +1,197 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+
+	"github.com/Eun/yaegi-template/codebuffer"
+)
+
+type recordingTracer struct {
+	events []string
+}
+
+func (r *recordingTracer) TemplateStart(name string) {
+	r.events = append(r.events, "start "+name)
+}
+
+func (r *recordingTracer) TemplateEnd(name string, duration time.Duration) {
+	r.events = append(r.events, "end "+name)
+}
+
+func (r *recordingTracer) BlockStart(name string, part codebuffer.Part) {
+	r.events = append(r.events, fmt.Sprintf("block %d:%d %s", part.Line, part.Column, strings.TrimSpace(string(part.Content))))
+}
+
+func (r *recordingTracer) BlockEnd(name string, part codebuffer.Part, duration time.Duration) {
+	r.events = append(r.events, fmt.Sprintf("/block %d:%d", part.Line, part.Column))
+}
+
+func (r *recordingTracer) Error(name string, err error) {
+	r.events = append(r.events, "error "+strings.SplitN(err.Error(), "\n", 2)[0])
+}
+
+func TestTracer(t *testing.T) {
+	trace := func(t *testing.T, template string) ([]string, string, error) {
+		var tracer recordingTracer
+		tmpl := MustNew(interp.Options{}, stdlib.Symbols)
+		tmpl.Name = "test"
+		tmpl.Tracer = &tracer
+		tmpl.MustParseString(template)
+		var buf bytes.Buffer
+		_, err := tmpl.Exec(&buf, nil)
+		return tracer.events, buf.String(), err
+	}
+
+	t.Run("blocks", func(t *testing.T) {
+		events, output, err := trace(t, `<$ import "strings" $><$ s := "a" $>
+<$ for i := 0; i < 2; i++ { $><$= strings.ToUpper(s) $><$ } $>`)
+		require.NoError(t, err)
+		require.Equal(t, "\nAA", output)
+		require.Equal(t, []string{
+			"start test",
+			"block 1:25 s := \"a\"",
+			"/block 1:25",
+			"block 2:3 for i := 0; i < 2; i++ {",
+			"/block 2:3",
+			"block 2:33 = strings.ToUpper(s)",
+			"/block 2:33",
+			"block 2:58 }",
+			"/block 2:58",
+			"block 2:33 = strings.ToUpper(s)",
+			"/block 2:33",
+			"block 2:58 }",
+			"/block 2:58",
+			"end test",
+		}, events)
+	})
+
+	t.Run("branches", func(t *testing.T) {
+		events, output, err := trace(t, `<$ x := 2 $><$ if x == 1 { $>one<$ } else { $>other<$ } $><$ switch x { $><$ case 1: $>1<$ case 2: $>2<$ } $>`)
+		require.NoError(t, err)
+		require.Equal(t, "other2", output)
+		require.Equal(t, []string{
+			"start test",
+			"block 1:3 x := 2",
+			"/block 1:3",
+			"block 1:15 if x == 1 {",
+			"/block 1:15",
+			"block 1:35 } else {",
+			"/block 1:35",
+			"block 1:54 }",
+			"/block 1:54",
+			"block 1:61 switch x {",
+			"/block 1:61",
+			"block 1:91 case 2:",
+			"/block 1:91",
+			"block 1:105 }",
+			"/block 1:105",
+			"end test",
+		}, events)
+	})
+
+	t.Run("macro", func(t *testing.T) {
+		events, output, err := trace(t, `<$ macro Hello(name string) $>Hello <$= name $><$ end $><$ Hello("Joe") $>`)
+		require.NoError(t, err)
+		require.Equal(t, "Hello Joe", output)
+		require.Equal(t, []string{
+			"start test",
+			"block 1:59 Hello(\"Joe\")",
+			"/block 1:59",
+			"block 1:3 macro Hello(name string)",
+			"/block 1:3",
+			"block 1:39 = name",
+			"/block 1:39",
+			"block 1:50 end",
+			"/block 1:50",
+			"end test",
+		}, events)
+	})
+
+	t.Run("files", func(t *testing.T) {
+		// ExecFiles is traced as one execution
+		var tracer recordingTracer
+		tmpl := MustNew(interp.Options{}, stdlib.Symbols)
+		tmpl.Name = "test"
+		tmpl.Tracer = &tracer
+		tmpl.MustParseString(`<$ file("a.txt") $>A<$ file("b.txt") $>B`)
+		files, err := tmpl.ExecFiles(nil)
+		require.NoError(t, err)
+		require.Len(t, files, 2)
+		require.Equal(t, []string{
+			"start test",
+			"block 1:3 file(\"a.txt\")",
+			"/block 1:3",
+			"block 1:23 file(\"b.txt\")",
+			"/block 1:23",
+			"end test",
+		}, tracer.events)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		events, _, err := trace(t, `<$ panic("Oh no") $>`)
+		var panicErr *PanicError
+		require.True(t, errors.As(err, &panicErr))
+		require.Equal(t, PanicFrame{Line: 1, Column: 4}, PanicFrame{Line: panicErr.Line, Column: panicErr.Column})
+		require.Equal(t, []string{
+			"start test",
+			"block 1:3 panic(\"Oh no\")",
+			"/block 1:3",
+			"error error during execution of",
+			"end test",
+		}, events)
+	})
+}
+
+func TestChromeTracer(t *testing.T) {
+	tracer := NewChromeTracer()
+	template := MustNew(interp.Options{}, stdlib.Symbols)
+	template.Name = "page"
+	template.Tracer = tracer
+	template.MustParseString(`<$ for i := 0; i < 3; i++ { $>.<$ } $><$ panic("Oh no") $>`)
+	_, err := template.Exec(&bytes.Buffer{}, nil)
+	require.Error(t, err)
+
+	var buf bytes.Buffer
+	_, err = tracer.WriteTo(&buf)
+	require.NoError(t, err)
+
+	var trace struct {
+		TraceEvents []struct {
+			Name     string                 `json:"name"`
+			Category string                 `json:"cat"`
+			Phase    string                 `json:"ph"`
+			Time     float64                `json:"ts"`
+			Duration float64                `json:"dur"`
+			Args     map[string]interface{} `json:"args"`
+		} `json:"traceEvents"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &trace))
+
+	var names []string
+	for _, event := range trace.TraceEvents {
+		names = append(names, event.Phase+" "+event.Name)
+		require.GreaterOrEqual(t, event.Time, 0.0)
+	}
+	require.Equal(t, []string{
+		"X 1:3 for i := 0; i < 3; i++ {",
+		"X 1:34 }",
+		"X 1:34 }",
+		"X 1:34 }",
+		"X 1:41 panic(\"Oh no\")",
+		"i error",
+		"X page",
+	}, names)
+	require.Equal(t, float64(41), trace.TraceEvents[4].Args["column"])
+	require.Equal(t, "page", trace.TraceEvents[6].Args["template"])
+	require.Contains(t, trace.TraceEvents[5].Args["error"], "Oh no")
+}
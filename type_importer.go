@@ -0,0 +1,395 @@
+package yaegi_template
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/traefik/yaegi/interp"
+)
+
+// typeImporter is a types.Importer that creates the packages from the exports of the interpreter,
+// so templates can be type checked against the symbols that are available during the execution.
+type typeImporter struct {
+	fset *token.FileSet
+	// symbols holds the symbols of the packages by their import path.
+	symbols map[string]map[string]reflect.Value
+	// names holds the package names by their import path.
+	names map[string]string
+	// unfiltered holds the import paths and the symbols before the Policy was applied.
+	unfiltered map[string]map[string]reflect.Value
+	// sources returns the files of a go source package, it returns nil if the package does not exist.
+	sources func(importPath string) (map[string]string, error)
+
+	packages map[string]*types.Package
+	types    map[reflect.Type]types.Type
+	loading  map[string]bool
+}
+
+func newTypeImporter(fset *token.FileSet, exports, unfiltered interp.Exports) *typeImporter {
+	imp := &typeImporter{
+		fset:       fset,
+		symbols:    make(map[string]map[string]reflect.Value),
+		names:      make(map[string]string),
+		unfiltered: make(map[string]map[string]reflect.Value),
+		packages:   make(map[string]*types.Package),
+		types:      make(map[reflect.Type]types.Type),
+		loading:    make(map[string]bool),
+	}
+	for key, symbols := range exports {
+		// the keys have the form import/path/name
+		importPath := path.Dir(key)
+		if imp.symbols[importPath] == nil {
+			imp.symbols[importPath] = make(map[string]reflect.Value)
+		}
+		for name, value := range symbols {
+			imp.symbols[importPath][name] = value
+		}
+		imp.names[importPath] = path.Base(key)
+	}
+	for key, symbols := range unfiltered {
+		importPath := path.Dir(key)
+		if imp.unfiltered[importPath] == nil {
+			imp.unfiltered[importPath] = make(map[string]reflect.Value)
+		}
+		for name, value := range symbols {
+			imp.unfiltered[importPath][name] = value
+		}
+	}
+	return imp
+}
+
+// Import implements types.Importer.
+func (imp *typeImporter) Import(importPath string) (*types.Package, error) {
+	if importPath == "unsafe" {
+		return types.Unsafe, nil
+	}
+	if pkg, ok := imp.packages[importPath]; ok && pkg.Complete() {
+		return pkg, nil
+	}
+	if symbols, ok := imp.symbols[importPath]; ok {
+		return imp.binaryPackage(importPath, symbols), nil
+	}
+	if imp.sources != nil {
+		files, err := imp.sources(importPath)
+		if err != nil {
+			return nil, err
+		}
+		if files != nil {
+			return imp.sourcePackage(importPath, files)
+		}
+	}
+	if _, ok := imp.unfiltered[importPath]; ok {
+		return nil, errors.Errorf("package %s is not allowed", importPath)
+	}
+	return nil, errors.Errorf("package %s is not available", importPath)
+}
+
+// allowed returns false if the symbol of the package exists, but was removed by the Policy.
+func (imp *typeImporter) allowed(importPath, name string) bool {
+	if _, ok := imp.symbols[importPath][name]; ok {
+		return true
+	}
+	_, ok := imp.unfiltered[importPath][name]
+	return !ok
+}
+
+// pkg returns the package with the import path, it gets created if it does not exist yet.
+func (imp *typeImporter) pkg(importPath, name string) *types.Package {
+	if pkg, ok := imp.packages[importPath]; ok {
+		return pkg
+	}
+	if n, ok := imp.names[importPath]; ok {
+		name = n
+	}
+	pkg := types.NewPackage(importPath, name)
+	imp.packages[importPath] = pkg
+	return pkg
+}
+
+// binaryPackage creates the package from the symbols of the interpreter.
+func (imp *typeImporter) binaryPackage(importPath string, symbols map[string]reflect.Value) *types.Package {
+	pkg := imp.pkg(importPath, path.Base(importPath))
+	scope := pkg.Scope()
+
+	names := make([]string, 0, len(symbols))
+	for name := range symbols {
+		if !strings.HasPrefix(name, "_") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if obj := imp.object(pkg, name, symbols[name]); obj != nil && scope.Lookup(name) == nil {
+			scope.Insert(obj)
+		}
+	}
+	pkg.MarkComplete()
+	return pkg
+}
+
+// object returns the object for the symbol, the values are interpreted like the interpreter does:
+// types are nil pointers, variables are addressable and untyped constants are constant.Value.
+func (imp *typeImporter) object(pkg *types.Package, name string, value reflect.Value) types.Object {
+	if !value.IsValid() {
+		return nil
+	}
+	if value.CanAddr() || !value.CanInterface() {
+		return types.NewVar(token.NoPos, pkg, name, imp.typeOf(value.Type()))
+	}
+	if c, ok := value.Interface().(constant.Value); ok {
+		return types.NewConst(token.NoPos, pkg, name, untypedType(c), c)
+	}
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			break
+		}
+		typ := imp.typeOf(value.Type().Elem())
+		if named, ok := typ.(*types.Named); ok && named.Obj().Pkg() == pkg && named.Obj().Name() == name {
+			return named.Obj()
+		}
+		return types.NewTypeName(token.NoPos, pkg, name, typ)
+	case reflect.Func:
+		return types.NewFunc(token.NoPos, pkg, name, imp.signature(nil, value.Type(), 0))
+	}
+	if c := typedConstant(value); c != nil {
+		return types.NewConst(token.NoPos, pkg, name, imp.typeOf(value.Type()), c)
+	}
+	return types.NewVar(token.NoPos, pkg, name, imp.typeOf(value.Type()))
+}
+
+func untypedType(c constant.Value) types.Type {
+	switch c.Kind() {
+	case constant.Bool:
+		return types.Typ[types.UntypedBool]
+	case constant.String:
+		return types.Typ[types.UntypedString]
+	case constant.Int:
+		return types.Typ[types.UntypedInt]
+	case constant.Float:
+		return types.Typ[types.UntypedFloat]
+	case constant.Complex:
+		return types.Typ[types.UntypedComplex]
+	}
+	return types.Typ[types.Invalid]
+}
+
+// typedConstant returns the constant value of a basic value, it returns nil for other values.
+func typedConstant(value reflect.Value) constant.Value {
+	switch value.Kind() {
+	case reflect.Bool:
+		return constant.MakeBool(value.Bool())
+	case reflect.String:
+		return constant.MakeString(value.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return constant.MakeInt64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return constant.MakeUint64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return constant.MakeFloat64(value.Float())
+	}
+	return nil
+}
+
+var basicKinds = map[reflect.Kind]types.BasicKind{
+	reflect.Bool:          types.Bool,
+	reflect.Int:           types.Int,
+	reflect.Int8:          types.Int8,
+	reflect.Int16:         types.Int16,
+	reflect.Int32:         types.Int32,
+	reflect.Int64:         types.Int64,
+	reflect.Uint:          types.Uint,
+	reflect.Uint8:         types.Uint8,
+	reflect.Uint16:        types.Uint16,
+	reflect.Uint32:        types.Uint32,
+	reflect.Uint64:        types.Uint64,
+	reflect.Uintptr:       types.Uintptr,
+	reflect.Float32:       types.Float32,
+	reflect.Float64:       types.Float64,
+	reflect.Complex64:     types.Complex64,
+	reflect.Complex128:    types.Complex128,
+	reflect.String:        types.String,
+	reflect.UnsafePointer: types.UnsafePointer,
+}
+
+// typeOf returns the type for the reflect type.
+func (imp *typeImporter) typeOf(rt reflect.Type) types.Type {
+	if typ, ok := imp.types[rt]; ok {
+		return typ
+	}
+	if rt.Name() == "" || rt.PkgPath() == "" {
+		if rt.Name() == "error" && rt.Kind() == reflect.Interface {
+			return types.Universe.Lookup("error").Type()
+		}
+		if kind, ok := basicKinds[rt.Kind()]; ok && (rt.Name() != "" || rt.Kind() == reflect.UnsafePointer) {
+			// predeclared types, byte and rune are aliases of uint8 and int32
+			return types.Typ[kind]
+		}
+		typ := imp.underlying(rt, nil)
+		imp.types[rt] = typ
+		return typ
+	}
+
+	// named type, the package name is the prefix of the type string (e.g. os for os.File)
+	name := rt.String()
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+	pkg := imp.pkg(rt.PkgPath(), name)
+	obj := types.NewTypeName(token.NoPos, pkg, rt.Name(), nil)
+	named := types.NewNamed(obj, nil, nil)
+	imp.types[rt] = named
+	named.SetUnderlying(imp.underlying(rt, pkg))
+
+	if rt.Kind() == reflect.Interface || rt.Kind() == reflect.Ptr {
+		return named
+	}
+	ptr := reflect.PtrTo(rt)
+	for i := 0; i < ptr.NumMethod(); i++ {
+		m := ptr.Method(i)
+		var recvType types.Type = types.NewPointer(named)
+		if _, ok := rt.MethodByName(m.Name); ok {
+			recvType = named
+		}
+		recv := types.NewVar(token.NoPos, pkg, "", recvType)
+		named.AddMethod(types.NewFunc(token.NoPos, pkg, m.Name, imp.signature(recv, m.Type, 1)))
+	}
+	return named
+}
+
+// underlying returns the type structure of rt, pkg is the package of the named type (or nil).
+func (imp *typeImporter) underlying(rt reflect.Type, pkg *types.Package) types.Type {
+	if kind, ok := basicKinds[rt.Kind()]; ok {
+		return types.Typ[kind]
+	}
+	switch rt.Kind() {
+	case reflect.Ptr:
+		return types.NewPointer(imp.typeOf(rt.Elem()))
+	case reflect.Slice:
+		return types.NewSlice(imp.typeOf(rt.Elem()))
+	case reflect.Array:
+		return types.NewArray(imp.typeOf(rt.Elem()), int64(rt.Len()))
+	case reflect.Map:
+		return types.NewMap(imp.typeOf(rt.Key()), imp.typeOf(rt.Elem()))
+	case reflect.Chan:
+		dir := types.SendRecv
+		switch rt.ChanDir() {
+		case reflect.SendDir:
+			dir = types.SendOnly
+		case reflect.RecvDir:
+			dir = types.RecvOnly
+		}
+		return types.NewChan(dir, imp.typeOf(rt.Elem()))
+	case reflect.Func:
+		return imp.signature(nil, rt, 0)
+	case reflect.Struct:
+		fields := make([]*types.Var, rt.NumField())
+		tags := make([]string, rt.NumField())
+		for i := range fields {
+			f := rt.Field(i)
+			fieldPkg := pkg
+			if f.PkgPath != "" {
+				fieldPkg = imp.pkg(f.PkgPath, path.Base(f.PkgPath))
+			}
+			fields[i] = types.NewField(token.NoPos, fieldPkg, f.Name, imp.typeOf(f.Type), f.Anonymous)
+			tags[i] = string(f.Tag)
+		}
+		return types.NewStruct(fields, tags)
+	case reflect.Interface:
+		methods := make([]*types.Func, rt.NumMethod())
+		for i := range methods {
+			m := rt.Method(i)
+			methodPkg := pkg
+			if m.PkgPath != "" {
+				methodPkg = imp.pkg(m.PkgPath, path.Base(m.PkgPath))
+			}
+			methods[i] = types.NewFunc(token.NoPos, methodPkg, m.Name, imp.signature(nil, m.Type, 0))
+		}
+		return types.NewInterfaceType(methods, nil).Complete()
+	}
+	return types.Typ[types.Invalid]
+}
+
+// signature returns the signature of the function type rt, the first skip parameters are ignored.
+func (imp *typeImporter) signature(recv *types.Var, rt reflect.Type, skip int) *types.Signature {
+	params := make([]*types.Var, 0, rt.NumIn())
+	for i := skip; i < rt.NumIn(); i++ {
+		params = append(params, types.NewParam(token.NoPos, nil, "", imp.typeOf(rt.In(i))))
+	}
+	results := make([]*types.Var, 0, rt.NumOut())
+	for i := 0; i < rt.NumOut(); i++ {
+		results = append(results, types.NewParam(token.NoPos, nil, "", imp.typeOf(rt.Out(i))))
+	}
+	//nolint:staticcheck // NewSignatureType requires go1.18
+	return types.NewSignature(recv, types.NewTuple(params...), types.NewTuple(results...), rt.IsVariadic())
+}
+
+// sourcePackage parses and type checks a go source package.
+func (imp *typeImporter) sourcePackage(importPath string, sources map[string]string) (*types.Package, error) {
+	if imp.loading[importPath] {
+		return nil, errors.Errorf("import cycle in package %s", importPath)
+	}
+	imp.loading[importPath] = true
+	defer delete(imp.loading, importPath)
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		if strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	files := make([]*ast.File, 0, len(names))
+	for _, name := range names {
+		f, err := parser.ParseFile(imp.fset, path.Join(importPath, name), sources[name], 0)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse package %s", importPath)
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: imp}
+	pkg, err := conf.Check(importPath, imp.fset, files, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "package %s has errors", importPath)
+	}
+	imp.packages[importPath] = pkg
+	return pkg, nil
+}
+
+// dirSources returns the go files of the package in the src directory of gopath, it returns nil if the package
+// does not exist.
+func dirSources(gopath, importPath string) (map[string]string, error) {
+	if gopath == "" {
+		return nil, nil
+	}
+	dir := filepath.Join(gopath, "src", filepath.FromSlash(importPath))
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil //nolint:nilerr // the package does not exist
+	}
+	sources := make(map[string]string)
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".go") {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read package %s", importPath)
+		}
+		sources[info.Name()] = string(b)
+	}
+	if len(sources) == 0 {
+		return nil, nil
+	}
+	return sources, nil
+}
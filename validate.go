@@ -0,0 +1,488 @@
+package yaegi_template
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ValidationError is returned by Validate, it holds all problems that were found in the template.
+type ValidationError struct {
+	Problems []ValidationProblem
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("template is invalid")
+	for _, p := range e.Problems {
+		sb.WriteString("\n")
+		sb.WriteString(p.String())
+	}
+	return sb.String()
+}
+
+// ValidationProblem is a problem that was found by Validate.
+// Line and Column are the position in the template, they are 0 if the problem has no position in the template
+// (e.g. a problem in the prelude).
+type ValidationProblem struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (p ValidationProblem) String() string {
+	if p.Line == 0 {
+		return p.Message
+	}
+	return fmt.Sprintf("%d:%d: %s", p.Line, p.Column, p.Message)
+}
+
+// Validate checks the template without executing it.
+// The code blocks are parsed and type checked as part of the assembled program, against the symbols that are
+// available to the template and the type of context. It reports syntax errors, undefined identifiers, unused imports
+// and symbols that are not allowed by the Policy, the problems are returned as *ValidationError:
+//    template := yaegi_template.MustNew(yaegi_template.DefaultOptions(), yaegi_template.DefaultSymbols()...)
+//    if err := template.LazyParse(upload); err != nil {
+//        return err
+//    }
+//    if err := template.Validate(User{}); err != nil {
+//        return err
+//    }
+// context should be a value of the type that is later passed to Exec(), if it is nil the template can not use
+// context. Note that the ImportHook is not called during the validation.
+func (t *Template) Validate(context interface{}) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.codeBuffer == nil {
+		return errors.New("template was never parsed")
+	}
+
+	var prog program
+	if err := t.compile(&prog); err != nil {
+		return err
+	}
+	v, err := t.newValidator(&prog, context)
+	if err != nil {
+		return err
+	}
+	return v.check()
+}
+
+// newValidator assembles the program for the type check.
+func (t *Template) newValidator(prog *program, context interface{}) (*validator, error) {
+	v := validator{
+		prog: prog,
+		fset: token.NewFileSet(),
+	}
+	if err := v.assemble(t); err != nil {
+		return nil, err
+	}
+
+	v.internals = t.internals()
+	for name, value := range t.filters.exports() {
+		v.internals[name] = value
+	}
+	if context != nil {
+		v.internals["context"] = reflect.New(reflect.TypeOf(context)).Elem()
+	}
+	if prog.meta != nil {
+		v.internals["meta"] = reflect.ValueOf(&prog.meta).Elem()
+	}
+	v.importer = newTypeImporter(v.fset, t.exports(), t.unfilteredExports())
+	v.importer.sources = func(importPath string) (map[string]string, error) {
+		if files, ok := t.sourcePackages[importPath]; ok {
+			return files, nil
+		}
+		return dirSources(t.options.GoPath, importPath)
+	}
+	return &v, nil
+}
+
+// MustValidate is like Validate, except it panics on failure.
+func (t *Template) MustValidate(context interface{}) *Template {
+	if err := t.Validate(context); err != nil {
+		panic(err.Error())
+	}
+	return t
+}
+
+// validationSegment is a part of a file that is assembled by the validator.
+type validationSegment struct {
+	kind   segmentKind
+	offset int
+	size   int
+	// line and column are the position of imports in the template
+	line   int
+	column int
+}
+
+type segmentKind int
+
+const (
+	// generatedSegment is code that was added by the validator.
+	generatedSegment segmentKind = iota
+	// implicitSegment is an import that is not part of the template (e.g. an import of the prelude).
+	implicitSegment
+	// importSegment is an import of the template.
+	importSegment
+	// codeSegment is the code of the program.
+	codeSegment
+	// macrosSegment is the code of the macros.
+	macrosSegment
+	// preludeSegment is the code of a prelude.
+	preludeSegment
+)
+
+// validationFile is a file that is assembled by the validator.
+type validationFile struct {
+	name     string
+	src      bytes.Buffer
+	segments []validationSegment
+	// imports holds the names of the imports of the template, that are explicit in the file
+	imports map[string]bool
+}
+
+func (f *validationFile) write(s string, segment validationSegment) {
+	segment.offset = f.src.Len()
+	segment.size = len(s)
+	f.segments = append(f.segments, segment)
+	f.src.WriteString(s)
+}
+
+func (f *validationFile) writeImport(imp Import, segment validationSegment) {
+	key := imp.Name + " " + imp.Path
+	if f.imports[key] {
+		return
+	}
+	f.imports[key] = true
+	f.write("import "+imp.Name+" "+strconv.Quote(imp.Path)+"\n", segment)
+}
+
+// segment returns the segment at offset of the file.
+// Offsets in generated code after the code (e.g. a missing brace at the end of main) belong to the end of the code.
+func (f *validationFile) segment(offset int) (validationSegment, int, bool) {
+	for i, s := range f.segments {
+		if offset < s.offset || offset > s.offset+s.size {
+			continue
+		}
+		if s.kind == generatedSegment && i > 0 {
+			if prev := f.segments[i-1]; prev.kind == codeSegment || prev.kind == macrosSegment {
+				return prev, prev.size, true
+			}
+		}
+		return s, offset - s.offset, true
+	}
+	return validationSegment{}, 0, false
+}
+
+// validator type checks the assembled program of a template.
+type validator struct {
+	prog     *program
+	fset     *token.FileSet
+	template validationFile
+	prelude  validationFile
+	problems []ValidationProblem
+	importer *typeImporter
+	// internals are the internal symbols, that are declared in the package scope
+	internals map[string]reflect.Value
+	info      *types.Info
+	// wrapped is true if the code is wrapped in a main function
+	wrapped bool
+	// lastCall is the call that is the last statement of the code
+	lastCall *ast.CallExpr
+}
+
+// assemble assembles the files that get type checked.
+// The prelude file holds the preludes, the template file holds the macros and the code. Like the interpreter does,
+// the code is wrapped in a main function, unless it starts with a declaration or a package clause:
+//    package main
+//    import "strings"     // imports of the template
+//    import "fmt"         // implicit imports (e.g. of Import())
+//    func Card(...) {...} // macros
+//    func main() {
+//        ...              // code, without the imports and the package clause
+//    }
+func (v *validator) assemble(t *Template) error {
+	v.template = validationFile{name: "template.go", imports: make(map[string]bool)}
+	v.prelude = validationFile{name: "prelude.go", imports: make(map[string]bool)}
+
+	code, templateImports, err := blankImports(v.prog.code.String())
+	if err != nil {
+		// the syntax error gets reported by the check
+		code, templateImports = v.prog.code.String(), nil
+	}
+
+	v.template.write("package main\n", validationSegment{})
+	for _, imp := range templateImports {
+		line, column := v.prog.position(false, imp.offset)
+		v.template.writeImport(imp.Import, validationSegment{kind: importSegment, line: line, column: column})
+	}
+
+	v.prelude.write("package main\n", validationSegment{})
+	var preludes []string
+	implicit := append(importSymbols{}, t.imports...)
+	for _, src := range t.prelude {
+		c, preludeImports, err := blankImports(src)
+		if err != nil {
+			return errors.Wrap(err, "unable to parse prelude")
+		}
+		preludes = append(preludes, c)
+		for _, imp := range preludeImports {
+			implicit = append(implicit, imp.Import)
+		}
+	}
+	for _, imp := range implicit {
+		v.template.writeImport(imp, validationSegment{kind: implicitSegment})
+		v.prelude.writeImport(imp, validationSegment{kind: implicitSegment})
+	}
+	for _, c := range preludes {
+		v.prelude.write(c+"\n", validationSegment{kind: preludeSegment})
+	}
+
+	v.template.write(v.prog.macros.String(), validationSegment{kind: macrosSegment})
+	header, footer := "\nfunc main() {\n", "\n}\n"
+	v.wrapped = !isDeclToken(firstToken(code))
+	if !v.wrapped {
+		header, footer = "\n", "\n"
+	}
+	v.template.write(header, validationSegment{})
+	v.template.write(code, validationSegment{kind: codeSegment})
+	v.template.write(footer, validationSegment{})
+	return nil
+}
+
+// check parses and type checks the assembled files.
+// The internal symbols are declared in the package scope, because dot imports only import exported symbols.
+func (v *validator) check() error {
+	var files []*ast.File
+	for _, f := range []*validationFile{&v.prelude, &v.template} {
+		file, err := parser.ParseFile(v.fset, f.name, f.src.Bytes(), parser.AllErrors)
+		if err != nil {
+			if list, ok := err.(scanner.ErrorList); ok {
+				for _, e := range list {
+					v.report(e.Pos, e.Msg)
+				}
+				continue
+			}
+			return err
+		}
+		files = append(files, file)
+	}
+	if len(v.problems) != 0 {
+		return v.result()
+	}
+
+	// the interpreter writes the value of the last statement to the output, so it is used
+	if v.wrapped {
+		template := files[len(files)-1]
+		if main, ok := template.Decls[len(template.Decls)-1].(*ast.FuncDecl); ok && len(main.Body.List) > 0 {
+			last := len(main.Body.List) - 1
+			if stmt, ok := main.Body.List[last].(*ast.ExprStmt); ok {
+				if call, ok := stmt.X.(*ast.CallExpr); ok {
+					v.lastCall = call
+				} else {
+					main.Body.List[last] = &ast.AssignStmt{
+						Lhs: []ast.Expr{&ast.Ident{NamePos: stmt.Pos(), Name: "_"}},
+						Tok: token.ASSIGN,
+						Rhs: []ast.Expr{stmt.X},
+					}
+				}
+			}
+		}
+	}
+
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	v.info = info
+	var typeErrors []types.Error
+	conf := types.Config{
+		Importer: v.importer,
+		Error: func(err error) {
+			if e, ok := err.(types.Error); ok {
+				typeErrors = append(typeErrors, e)
+			}
+		},
+	}
+	pkg := types.NewPackage("main", "main")
+	for name, value := range v.internals {
+		if obj := v.importer.object(pkg, name, value); obj != nil {
+			pkg.Scope().Insert(obj)
+		}
+	}
+	_ = types.NewChecker(&conf, v.fset, pkg, info).Files(files)
+
+	notAllowed := make(map[token.Pos]string)
+	for _, file := range files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			sel, ok := node.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			ident, ok := sel.X.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if pkgName, ok := info.Uses[ident].(*types.PkgName); ok {
+				importPath := pkgName.Imported().Path()
+				if !v.importer.allowed(importPath, sel.Sel.Name) {
+					notAllowed[sel.Sel.Pos()] = fmt.Sprintf("%s.%s is not allowed", importPath, sel.Sel.Name)
+				}
+			}
+			return true
+		})
+	}
+
+	for _, e := range typeErrors {
+		// the interpreter does not complain about unused variables
+		if strings.Contains(e.Msg, "declared and not used") || strings.Contains(e.Msg, "declared but not used") {
+			continue
+		}
+		msg := e.Msg
+		if m, ok := notAllowed[e.Pos]; ok {
+			msg = m
+		}
+		v.report(e.Fset.Position(e.Pos), msg)
+	}
+	return v.result()
+}
+
+// lastCallResults returns the number of results of the call that is the last statement of the code, ok is false if
+// the last statement is no call or the type of the call is unknown (e.g. because of an error).
+func (v *validator) lastCallResults() (n int, ok bool) {
+	if v.lastCall == nil || v.info == nil {
+		return 0, false
+	}
+	tv, ok := v.info.Types[v.lastCall]
+	if !ok || tv.Type == nil {
+		return 0, false
+	}
+	if basic, ok := tv.Type.(*types.Basic); ok && basic.Kind() == types.Invalid {
+		return 0, false
+	}
+	if tuple, ok := tv.Type.(*types.Tuple); ok {
+		return tuple.Len(), true
+	}
+	return 1, true
+}
+
+// report adds the problem at the position of an assembled file.
+func (v *validator) report(pos token.Position, msg string) {
+	f := &v.template
+	if pos.Filename == v.prelude.name {
+		f = &v.prelude
+	}
+	segment, offset, ok := f.segment(pos.Offset)
+	if !ok {
+		v.problems = append(v.problems, ValidationProblem{Message: msg})
+		return
+	}
+	problem := ValidationProblem{Message: msg}
+	switch segment.kind {
+	case implicitSegment:
+		// problems of imports that are not part of the template (e.g. unused imports)
+		return
+	case importSegment:
+		problem.Line, problem.Column = segment.line, segment.column
+	case codeSegment:
+		problem.Line, problem.Column = v.prog.position(false, offset)
+	case macrosSegment:
+		problem.Line, problem.Column = v.prog.position(true, offset)
+	case preludeSegment:
+		if strings.Contains(msg, "imported and not used") {
+			return
+		}
+		problem.Message = "prelude: " + msg
+	}
+	v.problems = append(v.problems, problem)
+}
+
+// result returns the problems as *ValidationError, or nil if there are none.
+func (v *validator) result() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		a, b := v.problems[i], v.problems[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	problems := v.problems[:0]
+	for i, p := range v.problems {
+		if i == 0 || p != v.problems[i-1] {
+			problems = append(problems, p)
+		}
+	}
+	return &ValidationError{Problems: problems}
+}
+
+// codeImport is an import of a code block.
+type codeImport struct {
+	Import
+	// offset is the offset of the import in the code.
+	offset int
+}
+
+// blankImports returns the code with the import declarations and the package clause replaced by spaces, so the
+// offsets of the code stay the same, and the imports that were removed.
+func blankImports(code string) (string, []codeImport, error) {
+	prefix := "package main;"
+	if firstToken(code) == token.PACKAGE {
+		prefix = ""
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "", prefix+code, parser.ImportsOnly)
+	if err != nil {
+		return "", nil, err
+	}
+	b := []byte(code)
+	if prefix == "" {
+		// the interpreter removes the package clause as well
+		for i := int(f.Package) - 1; i < int(f.Name.End())-1; i++ {
+			b[i] = ' '
+		}
+	}
+	var imports []codeImport
+	for _, decl := range f.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			importSpec, ok := spec.(*ast.ImportSpec)
+			if !ok {
+				continue
+			}
+			importPath, err := strconv.Unquote(importSpec.Path.Value)
+			if err != nil {
+				return "", nil, err
+			}
+			imp := codeImport{
+				Import: Import{Path: importPath},
+				offset: int(importSpec.Pos()) - 1 - len(prefix),
+			}
+			if importSpec.Name != nil {
+				imp.Name = importSpec.Name.Name
+			}
+			imports = append(imports, imp)
+		}
+		for i := int(genDecl.Pos()) - 1 - len(prefix); i < int(genDecl.End())-1-len(prefix); i++ {
+			if b[i] != '\n' {
+				b[i] = ' '
+			}
+		}
+	}
+	return string(b), imports, nil
+}
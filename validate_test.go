@@ -0,0 +1,132 @@
+package yaegi_template
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+func TestValidate(t *testing.T) {
+	type User struct {
+		Name string
+	}
+
+	validate := func(t *testing.T, template string, context interface{}) []ValidationProblem {
+		tmpl := MustNew(interp.Options{}, DefaultSymbols()...)
+		tmpl.MustLazyParse(strings.NewReader(template))
+		err := tmpl.Validate(context)
+		if err == nil {
+			return nil
+		}
+		verr, ok := err.(*ValidationError)
+		require.True(t, ok, err.Error())
+		return verr.Problems
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		problems := validate(t, `<$ import "strings" $>
+<$ macro Greet(name string) $>Hello <$= strings.ToUpper(name) $><$ end $>
+<$ for i := 0; i < 3; i++ { $><$ Greet(context.Name) $><$ } $>
+<$= context.Name | upper $>`, User{})
+		require.Empty(t, problems)
+	})
+
+	t.Run("undefined", func(t *testing.T) {
+		problems := validate(t, "Hello\n<$= context.Nme $>\n<$ foo() $>", User{})
+		require.Len(t, problems, 2)
+		require.Equal(t, 2, problems[0].Line)
+		require.Equal(t, 13, problems[0].Column)
+		require.Contains(t, problems[0].Message, "Nme")
+		require.Equal(t, ValidationProblem{Line: 3, Column: 4, Message: "undefined: foo"}, problems[1])
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		problems := validate(t, "<$ x := $>", nil)
+		require.NotEmpty(t, problems)
+		require.Equal(t, 1, problems[0].Line)
+	})
+
+	t.Run("unused import", func(t *testing.T) {
+		problems := validate(t, "<$\nimport \"strings\" $>Hello", nil)
+		require.Len(t, problems, 1)
+		require.Equal(t, 2, problems[0].Line)
+		require.Equal(t, 8, problems[0].Column)
+		require.Contains(t, problems[0].Message, "imported and not used")
+	})
+
+	t.Run("context", func(t *testing.T) {
+		problems := validate(t, `<$= context + 1 $>`, "text")
+		require.Len(t, problems, 1)
+		require.Contains(t, problems[0].Message, "mismatched types")
+
+		problems = validate(t, `<$= context $>`, nil)
+		require.Len(t, problems, 1)
+		require.Equal(t, "undefined: context", problems[0].Message)
+	})
+
+	t.Run("macro", func(t *testing.T) {
+		problems := validate(t, "<$ macro Card(title string) $>\n<$= title + 1 $><$ end $>", nil)
+		require.Len(t, problems, 1)
+		require.Equal(t, 2, problems[0].Line)
+	})
+
+	t.Run("last value", func(t *testing.T) {
+		require.Empty(t, validate(t, `<$ context $>`, 1))
+	})
+
+	t.Run("policy", func(t *testing.T) {
+		tmpl := MustNew(interp.Options{}, stdlib.Symbols)
+		tmpl.Policy = &Policy{Deny: []string{"os.Getenv", "net/http"}}
+		tmpl.MustLazyParse(strings.NewReader(`<$ import "os" $><$ import "net/http" $><$= os.Getenv("HOME") $><$ http.Get("") $>`))
+		err := tmpl.Validate(nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "os.Getenv is not allowed")
+		require.Contains(t, err.Error(), "package net/http is not allowed")
+	})
+
+	t.Run("prelude and source package", func(t *testing.T) {
+		tmpl := MustNew(interp.Options{}, stdlib.Symbols).
+			MustAddSourcePackage("acme/greet", map[string]string{
+				"greet.go": "package greet\nfunc Hello(name string) string { return \"Hello \" + name }",
+			}).
+			MustPrelude(`import "strings"
+func shout(s string) string { return strings.ToUpper(s) }`)
+		tmpl.MustLazyParse(strings.NewReader(`<$ import "acme/greet" $><$= shout(greet.Hello("Joe")) $>`))
+		require.NoError(t, tmpl.Validate(nil))
+	})
+
+	t.Run("not parsed", func(t *testing.T) {
+		require.Error(t, MustNew(interp.Options{}, stdlib.Symbols).Validate(nil))
+	})
+}
+
+func TestValidate_MatchesExec(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		valid    bool
+	}{
+		{"package", "<$ package main\nimport \"fmt\"\nfunc main() { fmt.Print(\"x\") } $>", true},
+		{"declarations", "<$ import \"strings\"\nvar s = strings.ToUpper(\"x\")\nfunc f() string { return s } $>", true},
+		{"statements", "<$ import \"strings\"\ns := strings.ToUpper(\"x\"); print(s) $>", true},
+		{"declaration and output", "<$ type T struct{ A int } $><$= T{A: 1}.A $>", false},
+		{"declaration and statement", "<$ var y int; _ = y $>", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl := MustNew(interp.Options{}, stdlib.Symbols).MustParseString(test.template)
+			_, execErr := tmpl.Exec(&strings.Builder{}, nil)
+			validateErr := tmpl.Validate(nil)
+			if test.valid {
+				require.NoError(t, execErr)
+				require.NoError(t, validateErr)
+				return
+			}
+			require.Error(t, execErr)
+			require.Error(t, validateErr)
+		})
+	}
+}